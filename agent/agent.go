@@ -0,0 +1,196 @@
+// Package agent forwards the windows aggregated by a local
+// server to an upstream myko server. Windows are spooled, to
+// disk if configured, and forwarded in the background.
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mykodev/myko/datastore/kusto"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Forwarder is the datastore of the agent's server.
+// It writes the windows to the upstream server.
+type Forwarder struct {
+	upstream pb.Service
+	spool    *Spool
+	added    chan struct{} // signals the requests added to the spool
+}
+
+// closeTimeout is how long Close tries to forward
+// the spooled requests.
+const closeTimeout = 10 * time.Second
+
+// NewForwarder returns a forwarder that sends windows to
+// upstream through spool.
+func NewForwarder(upstream pb.Service, spool *Spool) *Forwarder {
+	return &Forwarder{
+		upstream: upstream,
+		spool:    spool,
+		added:    make(chan struct{}, 1),
+	}
+}
+
+// IngestAll adds the entries to the spool as a request with
+// a new idempotency key, and Run forwards it. Retries of the
+// request keep the key, so upstream never counts it twice.
+// It fails only if the spool is full.
+func (f *Forwarder) IngestAll(ctx context.Context, entries []*kusto.Entry) error {
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	req := &pb.InsertEventsRequest{
+		Entries: toEntries(entries),
+		// Rejecting the invalid entries rather than the
+		// whole request, retries would be rejected too.
+		Partial:        true,
+		IdempotencyKey: key,
+		PreAggregated:  true,
+	}
+	if err := f.spool.Add(req); err != nil {
+		return err
+	}
+	select {
+	case f.added <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run forwards the spooled requests as they are added, and
+// retries them every interval until ctx is done.
+func (f *Forwarder) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.added:
+		case <-ticker.C:
+		}
+		if err := f.spool.Drain(ctx, f.send); err != nil {
+			log.Printf("Failed to forward the spooled entries: %v", err)
+		}
+	}
+}
+
+// send sends req upstream. Requests and entries rejected by
+// upstream are put aside in the spool rather than retried,
+// retries would be rejected too.
+func (f *Forwarder) send(ctx context.Context, req *pb.InsertEventsRequest) error {
+	resp, err := f.upstream.InsertEvents(ctx, req)
+	var twerr twirp.Error
+	if errors.As(err, &twerr) && twerr.Code() == twirp.InvalidArgument {
+		log.Printf("Upstream rejected %d entries: %v", len(req.Entries), err)
+		return f.spool.Reject(req)
+	}
+	if err != nil {
+		return err
+	}
+	if len(resp.Rejections) == 0 {
+		return nil
+	}
+	rejected := &pb.InsertEventsRequest{
+		Partial:        true,
+		IdempotencyKey: req.IdempotencyKey + "-rejected",
+		PreAggregated:  true,
+	}
+	for _, r := range resp.Rejections {
+		if int(r.Index) < len(req.Entries) {
+			rejected.Entries = append(rejected.Entries, req.Entries[r.Index])
+		}
+		log.Printf("Upstream rejected an entry: %s", r.Reason)
+	}
+	return f.spool.Reject(rejected)
+}
+
+// Query queries the upstream server. The results don't
+// include the windows that are not forwarded yet.
+func (f *Forwarder) Query(ctx context.Context, q kusto.Query) ([]*kusto.Entry, error) {
+	resp, err := f.upstream.Query(ctx, &pb.QueryRequest{
+		Target:    q.Target,
+		Origin:    q.Origin,
+		Event:     q.Event,
+		StartTime: timestamppb.New(q.StartTime),
+		EndTime:   timestamppb.New(q.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*kusto.Entry, 0, len(resp.Events))
+	for _, ev := range resp.Events {
+		entries = append(entries, &kusto.Entry{
+			Event:   ev.Name,
+			Kind:    ev.Kind.String(),
+			Value:   ev.Value,
+			Count:   int64(ev.Count),
+			Sketch:  ev.Sketch,
+			Decimal: ev.Decimal,
+		})
+	}
+	return entries, nil
+}
+
+// Close tries to forward the spooled requests. Requests
+// that fail to be forwarded are kept in the spool if it's
+// on disk, and lost otherwise.
+func (f *Forwarder) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	return f.spool.Drain(ctx, f.send)
+}
+
+// toEntries groups the datastore entries into an entry
+// per window, target and origin.
+func toEntries(kEntries []*kusto.Entry) []*pb.Entry {
+	type entryKey struct {
+		ts             time.Time
+		target, origin string
+	}
+	var entries []*pb.Entry
+	index := make(map[entryKey]*pb.Entry)
+	for _, e := range kEntries {
+		k := entryKey{e.Timestamp, e.Target, e.Origin}
+		entry, ok := index[k]
+		if !ok {
+			entry = &pb.Entry{
+				Target:    e.Target,
+				Origin:    e.Origin,
+				Timestamp: timestamppb.New(e.Timestamp),
+			}
+			index[k] = entry
+			entries = append(entries, entry)
+		}
+		entry.Events = append(entry.Events, &pb.Event{
+			Name:    e.Event,
+			Kind:    pb.Kind(pb.Kind_value[e.Kind]),
+			Value:   e.Value,
+			Count:   uint64(e.Count),
+			Sketch:  e.Sketch,
+			Decimal: e.Decimal,
+		})
+	}
+	return entries
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
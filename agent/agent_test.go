@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/datastore/kusto"
+	"github.com/mykodev/myko/mykotest"
+	"github.com/twitchtv/twirp"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestForwarder_Spool(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &mykotest.Service{}
+	upstream.Fail(errors.New("unavailable"))
+	f := NewForwarder(upstream, spool)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*kusto.Entry{
+		{Timestamp: start, Target: "mysql", Origin: "site_navbar", Event: "query_count", Kind: "SUM", Value: 2, Count: 2},
+		{Timestamp: start, Target: "mysql", Origin: "site_navbar", Event: "query_latency_ms", Kind: "SUM", Value: 10, Count: 2},
+		{Timestamp: start, Target: "redis", Origin: "site_navbar", Event: "query_count", Kind: "SUM", Value: 1, Count: 1},
+	}
+	ctx := context.Background()
+	if err := f.IngestAll(ctx, entries); err != nil {
+		t.Fatalf("IngestAll() = %v", err)
+	}
+	if spool.Size() == 0 {
+		t.Fatalf("Size() = 0, want the request spooled")
+	}
+
+	// Drain stops at the first failure and keeps the request
+	// with its idempotency key.
+	var keys []string
+	for i := 0; i < 2; i++ {
+		err := spool.Drain(ctx, func(ctx context.Context, req *pb.InsertEventsRequest) error {
+			keys = append(keys, req.IdempotencyKey)
+			return f.send(ctx, req)
+		})
+		if err == nil {
+			t.Fatalf("Drain() = nil, want error")
+		}
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("idempotency keys of the retries = %q, want the same key", keys)
+	}
+	upstream.Fail(nil)
+	if err := spool.Drain(ctx, f.send); err != nil {
+		t.Fatalf("Drain() = %v", err)
+	}
+	if spool.Size() != 0 {
+		t.Errorf("Size() = %v, want 0", spool.Size())
+	}
+
+	if len(upstream.Requests()) != 1 {
+		t.Fatalf("len(reqs) = %v, want 1", len(upstream.Requests()))
+	}
+	req := upstream.Requests()[0]
+	if !req.Partial || !req.PreAggregated || req.IdempotencyKey != keys[0] {
+		t.Errorf("Partial = %v, PreAggregated = %v, IdempotencyKey = %q", req.Partial, req.PreAggregated, req.IdempotencyKey)
+	}
+	if len(req.Entries) != 2 {
+		t.Fatalf("len(entries) = %v, want 2", len(req.Entries))
+	}
+	e := req.Entries[0]
+	if e.Target != "mysql" || !e.Timestamp.AsTime().Equal(start) || len(e.Events) != 2 {
+		t.Errorf("entry = %v", e)
+	}
+	if ev := e.Events[0]; ev.Name != "query_count" || ev.Value != 2 || ev.Count != 2 {
+		t.Errorf("event = %v", ev)
+	}
+}
+
+func TestForwarder_SpoolFull(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &mykotest.Service{}
+	upstream.Fail(errors.New("unavailable"))
+	f := NewForwarder(upstream, spool)
+	entries := []*kusto.Entry{{Timestamp: time.Now(), Target: "mysql", Origin: "site_navbar", Event: "query_count", Value: 1}}
+	if err := f.IngestAll(context.Background(), entries); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("IngestAll() = %v, want %v", err, ErrSpoolFull)
+	}
+}
+
+func TestForwarder_Rejected(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &mykotest.Service{}
+	upstream.Fail(twirp.NewError(twirp.InvalidArgument, "entry has no events"))
+	f := NewForwarder(upstream, spool)
+	entries := []*kusto.Entry{{Timestamp: time.Now(), Target: "mysql", Origin: "site_navbar", Event: "query_count", Value: 1}}
+	ctx := context.Background()
+	if err := f.IngestAll(ctx, entries); err != nil {
+		t.Fatalf("IngestAll() = %v", err)
+	}
+	if err := spool.Drain(ctx, f.send); err != nil {
+		t.Fatalf("Drain() = %v", err)
+	}
+	if spool.Size() != 0 {
+		t.Errorf("Size() = %v, want rejected requests not to be retried", spool.Size())
+	}
+	rejected, err := filepath.Glob(filepath.Join(dir, "*"+rejectedExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejected) != 1 {
+		t.Errorf("rejected files = %v, want the rejected request", rejected)
+	}
+}
+
+func TestForwarder_Memory(t *testing.T) {
+	spool, err := OpenSpool("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &mykotest.Service{}
+	f := NewForwarder(upstream, spool)
+	entries := []*kusto.Entry{{Timestamp: time.Now(), Target: "mysql", Origin: "site_navbar", Event: "query_count", Value: 1}}
+	if err := f.IngestAll(context.Background(), entries); err != nil {
+		t.Fatalf("IngestAll() = %v", err)
+	}
+	if len(upstream.Requests()) != 0 {
+		t.Errorf("IngestAll() has sent the request, want it spooled")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if len(upstream.Requests()) != 1 || spool.Size() != 0 {
+		t.Errorf("Close() has sent %d requests, want the spooled request", len(upstream.Requests()))
+	}
+}
@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mykodev/myko/atomicfile"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// ErrSpoolFull is returned if a request doesn't fit
+// into the spool.
+var ErrSpoolFull = errors.New("spool is full")
+
+// Spool keeps the requests to be forwarded, as files in a
+// directory, one marshaled request per file, or in memory.
+// Requests keep their idempotency keys, so requests that
+// reached upstream before failing are not counted twice.
+type Spool struct {
+	dir     string // empty if in memory
+	maxSize int64
+
+	mu   sync.Mutex // guards size, seq and reqs
+	size int64
+	seq  int
+	reqs map[string][]byte // requests of in-memory spools
+
+	drainMu sync.Mutex // held while draining
+}
+
+const (
+	spoolExt    = ".req"
+	rejectedExt = ".rejected"
+)
+
+// OpenSpool opens the spool in dir, creating it if needed.
+// If dir is empty, requests are kept in memory. Requests
+// are not added once the spooled requests exceed maxSize
+// bytes.
+func OpenSpool(dir string, maxSize int64) (*Spool, error) {
+	s := &Spool{dir: dir, maxSize: maxSize, reqs: make(map[string][]byte)}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	names, err := s.names(spoolExt)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		s.size += info.Size()
+	}
+	return s, nil
+}
+
+// Add adds req to the spool.
+func (s *Spool) Add(req *pb.InsertEventsRequest) error {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxSize > 0 && s.size+int64(len(b)) > s.maxSize {
+		return ErrSpoolFull
+	}
+	name := s.name(spoolExt)
+	if s.dir == "" {
+		s.reqs[name] = b
+	} else if err := atomicfile.Write(filepath.Join(s.dir, name), b); err != nil {
+		return err
+	}
+	s.size += int64(len(b))
+	return nil
+}
+
+// Reject keeps req aside as rejected, so it can be inspected
+// and resent manually. Rejected requests are not drained.
+// In-memory spools drop them.
+func (s *Spool) Reject(req *pb.InsertEventsRequest) error {
+	if s.dir == "" {
+		return nil
+	}
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	name := s.name(rejectedExt)
+	s.mu.Unlock()
+	return atomicfile.Write(filepath.Join(s.dir, name), b)
+}
+
+// name returns a new name with ext. Names sort in the order
+// they are created. The caller needs to hold s.mu.
+func (s *Spool) name(ext string) string {
+	s.seq++
+	return fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.seq, ext)
+}
+
+// Drain sends the spooled requests in the order they were
+// spooled and removes the sent ones. It stops at the first
+// request that fails to be sent.
+func (s *Spool) Drain(ctx context.Context, send func(context.Context, *pb.InsertEventsRequest) error) error {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	names, err := s.names(spoolExt)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		b, err := s.read(name)
+		if err != nil {
+			return err
+		}
+		var req pb.InsertEventsRequest
+		if err := proto.Unmarshal(b, &req); err != nil {
+			return fmt.Errorf("malformed spooled request %q: %w", name, err)
+		}
+		if err := send(ctx, &req); err != nil {
+			return err
+		}
+		if err := s.remove(name); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.size -= int64(len(b))
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Size returns the total size of the spooled requests in bytes.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// names returns the sorted names of the requests with ext.
+func (s *Spool) names(ext string) ([]string, error) {
+	var names []string
+	if s.dir == "" {
+		s.mu.Lock()
+		for name := range s.reqs {
+			names = append(names, name)
+		}
+		s.mu.Unlock()
+	} else {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && strings.HasSuffix(e.Name(), ext) {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Spool) read(name string) ([]byte, error) {
+	if s.dir != "" {
+		return os.ReadFile(filepath.Join(s.dir, name))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reqs[name], nil
+}
+
+func (s *Spool) remove(name string) error {
+	if s.dir != "" {
+		return os.Remove(filepath.Join(s.dir, name))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reqs, name)
+	return nil
+}
@@ -1,51 +1,225 @@
 package aggregator
 
 import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	pb "github.com/mykodev/myko/proto"
 )
 
 type Summer struct {
-	cap    int
-	events map[string]*pb.Event
+	cap      int
+	events   map[string]*pb.Event
+	sketches map[string]*HLL
+	counts   map[string]uint64 // observed events
+
+	scales map[string]int      // decimal places by event name
+	units  map[string]*big.Int // fixed-point sums, they don't overflow
 }
 
 func NewSummer(cap int) *Summer {
-	return &Summer{cap: cap, events: make(map[string]*pb.Event, cap)}
+	return &Summer{
+		cap:      cap,
+		events:   make(map[string]*pb.Event, cap),
+		sketches: make(map[string]*HLL),
+		counts:   make(map[string]uint64),
+		units:    make(map[string]*big.Int),
+	}
+}
+
+// Exact makes the summer sum the values of the events named
+// in scales as fixed-point decimals with the given number of
+// decimal places, so the sums don't drift as floating point
+// sums do. It returns the summer for convenience.
+func (s *Summer) Exact(scales map[string]int) *Summer {
+	s.scales = scales
+	return s
 }
 
 func (s *Summer) Size() int {
 	return len(s.events)
 }
 
-func (s *Summer) Add(target, origin string, ev *pb.Event) {
-	key := key(target, origin, ev.Name)
+// Add aggregates the event into the sum of the events with
+// the same target, origin, kind and name. DISTINCT events are
+// inserted into the sketch of the events with the same key.
+// Values of sampled events are scaled by their sample rate,
+// the observed events are counted separately.
+func (s *Summer) Add(target, origin string, ev *pb.Event) error {
+	key := key(target, origin, ev.Kind, ev.Name)
+	scale, exact := s.scales[ev.Name]
+
+	var err error
+	switch {
+	case ev.Kind == pb.Kind_DISTINCT:
+		err = s.addDistinct(key, ev)
+	case exact:
+		err = s.addExact(key, scale, ev)
+	default:
+		err = s.addSum(key, ev)
+	}
+	if err != nil {
+		return err
+	}
+
+	count := ev.Count
+	if count == 0 {
+		count = 1
+	}
+	s.counts[key] += count
+	return nil
+}
+
+func (s *Summer) addSum(key string, ev *pb.Event) error {
+	value := ev.Value
+	if ev.Decimal != "" {
+		// Decimals of events that are not summed exactly
+		// are summed as floating point numbers.
+		var err error
+		if value, err = strconv.ParseFloat(ev.Decimal, 64); err != nil {
+			return fmt.Errorf("malformed decimal %q", ev.Decimal)
+		}
+	}
 	v, ok := s.events[key]
 	if !ok {
-		s.events[key] = ev
-	} else {
-		v.Value += ev.Value
+		v = &pb.Event{Name: ev.Name}
 		s.events[key] = v
 	}
+	v.Value += value / sampleRate(ev)
+	return nil
+}
+
+func (s *Summer) addDistinct(key string, ev *pb.Event) error {
+	sketch, ok := s.sketches[key]
+	if !ok {
+		sketch = NewHLL()
+		s.sketches[key] = sketch
+		s.events[key] = &pb.Event{Name: ev.Name, Kind: pb.Kind_DISTINCT}
+	}
+	if len(ev.Sketch) > 0 {
+		other, err := ParseHLL(ev.Sketch)
+		if err != nil {
+			return err
+		}
+		sketch.Merge(other)
+	}
+	if ev.Id != "" {
+		sketch.Insert(ev.Id)
+	}
+	return nil
 }
 
+func (s *Summer) addExact(key string, scale int, ev *pb.Event) error {
+	units, err := exactUnits(ev, scale)
+	if err != nil {
+		return err
+	}
+	sum, ok := s.units[key]
+	if !ok {
+		sum = new(big.Int)
+		s.units[key] = sum
+		s.events[key] = &pb.Event{Name: ev.Name}
+	}
+	sum.Add(sum, big.NewInt(units))
+	return nil
+}
+
+// exactUnits returns the value of ev in units of 10^-scale,
+// scaled by the sample rate of ev.
+func exactUnits(ev *pb.Event, scale int) (int64, error) {
+	var units int64
+	var err error
+	if ev.Decimal != "" {
+		units, err = ParseDecimal(ev.Decimal, scale)
+	} else {
+		units, err = FloatToDecimal(ev.Value, scale)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if rate := sampleRate(ev); rate != 1 {
+		scaled := math.Round(float64(units) / rate)
+		if scaled >= math.MaxInt64 || scaled <= math.MinInt64 {
+			return 0, fmt.Errorf("value of event %q scaled by its sample rate is out of range", ev.Name)
+		}
+		units = int64(scaled)
+	}
+	return units, nil
+}
+
+// Verify returns an error if ev can't be added to a summer
+// summing the events in scales exactly, e.g. if its sketch or
+// decimal is malformed. Events that pass Verify are added
+// without errors, so callers can verify a batch of events
+// before adding any of them.
+func Verify(ev *pb.Event, scales map[string]int) error {
+	if ev.Kind == pb.Kind_DISTINCT {
+		if len(ev.Sketch) > 0 {
+			if _, err := ParseHLL(ev.Sketch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if scale, ok := scales[ev.Name]; ok {
+		_, err := exactUnits(ev, scale)
+		return err
+	}
+	if ev.Decimal != "" {
+		if _, err := strconv.ParseFloat(ev.Decimal, 64); err != nil {
+			return fmt.Errorf("malformed decimal %q", ev.Decimal)
+		}
+	}
+	return nil
+}
+
+// ForEach calls fn for every aggregated event. DISTINCT events
+// have their estimated count as value and carry their sketch.
+// Exact events carry their sum as a decimal string. Events carry
+// the number of observed events they aggregate as count.
 func (s *Summer) ForEach(fn func(target, origin string, event *pb.Event)) {
 	for k, ev := range s.events {
-		target, origin, _ := parseKey(k)
+		ev.Count = s.counts[k]
+		if sketch, ok := s.sketches[k]; ok {
+			ev.Value = float64(sketch.Estimate())
+			ev.Sketch = sketch.Bytes()
+		}
+		if units, ok := s.units[k]; ok {
+			scale := s.scales[ev.Name]
+			ev.Value = decimalValue(units, scale)
+			ev.Decimal = FormatDecimal(units, scale)
+		}
+		target, origin := parseKey(k)
 		fn(target, origin, ev)
 	}
 }
 
 func (s *Summer) Reset() {
 	s.events = make(map[string]*pb.Event, s.cap)
+	s.sketches = make(map[string]*HLL)
+	s.counts = make(map[string]uint64)
+	s.units = make(map[string]*big.Int)
+}
+
+// sampleRate returns the fraction of the events the client
+// has recorded. Unsampled events have a sample rate of 1.
+func sampleRate(ev *pb.Event) float64 {
+	if ev.SampleRate <= 0 || ev.SampleRate > 1 {
+		return 1
+	}
+	return ev.SampleRate
 }
 
-func key(target, origin, name string) string {
-	return target + ":" + origin + ":" + name
+// key keys the events by kind too, so sums and sketches of
+// events sharing a name are aggregated separately.
+func key(target, origin string, kind pb.Kind, name string) string {
+	return target + ":" + origin + ":" + kind.String() + ":" + name
 }
 
-func parseKey(key string) (target, origin, event string) {
-	v := strings.Split(key, ":")
-	return v[0], v[1], v[2]
+func parseKey(key string) (target, origin string) {
+	v := strings.SplitN(key, ":", 4)
+	return v[0], v[1]
 }
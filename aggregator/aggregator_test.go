@@ -2,6 +2,7 @@ package aggregator
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	pb "github.com/mykodev/myko/proto"
@@ -96,6 +97,189 @@ func TestSummer(t *testing.T) {
 	}
 }
 
+func TestSummer_Distinct(t *testing.T) {
+	s := NewSummer(256)
+	for i := 0; i < 100; i++ {
+		if err := s.Add("cluster1", "origin_1", &pb.Event{
+			Name: "customers",
+			Kind: pb.Kind_DISTINCT,
+			Id:   fmt.Sprintf("customer_%d", i%10),
+		}); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+
+	other := NewHLL()
+	for i := 5; i < 20; i++ {
+		other.Insert(fmt.Sprintf("customer_%d", i))
+	}
+	if err := s.Add("cluster1", "origin_1", &pb.Event{
+		Name:   "customers",
+		Kind:   pb.Kind_DISTINCT,
+		Sketch: other.Bytes(),
+	}); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	if size := s.Size(); size != 1 {
+		t.Errorf("Size = %v, want 1", size)
+	}
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		if ev.Value != 20 {
+			t.Errorf("Value = %v, want 20", ev.Value)
+		}
+		if len(ev.Sketch) == 0 {
+			t.Errorf("Sketch is empty")
+		}
+	})
+}
+
+func TestSummer_Kinds(t *testing.T) {
+	s := NewSummer(256)
+	for _, ev := range []*pb.Event{
+		{Name: "customers", Value: 5},
+		{Name: "customers", Kind: pb.Kind_DISTINCT, Id: "a"},
+	} {
+		if err := s.Add("cluster1", "origin_1", ev); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+
+	got := make(map[pb.Kind]float64)
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		if target != "cluster1" || origin != "origin_1" || ev.Count != 1 {
+			t.Errorf("event = %v/%v/%v", target, origin, ev)
+		}
+		got[ev.Kind] = ev.Value
+	})
+	want := map[pb.Kind]float64{pb.Kind_SUM: 5, pb.Kind_DISTINCT: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+}
+
+func TestSummer_Exact(t *testing.T) {
+	const n = 1000000
+
+	s := NewSummer(256).Exact(map[string]int{"invoice_usd": 6})
+	var floatSum float64
+	for i := 0; i < n; i++ {
+		ev := &pb.Event{Name: "invoice_usd", Value: 0.1}
+		floatSum += ev.Value
+		if err := s.Add("billing", "checkout", ev); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+		if err := s.Add("billing", "checkout", &pb.Event{Name: "refund_usd", Value: 0.1}); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+	if floatSum == 100000 {
+		t.Fatalf("floating point sum is expected to drift")
+	}
+
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		switch ev.Name {
+		case "invoice_usd":
+			if ev.Decimal != "100000.000000" {
+				t.Errorf("Decimal = %q, want %q", ev.Decimal, "100000.000000")
+			}
+			if ev.Value != 100000 {
+				t.Errorf("Value = %v, want 100000", ev.Value)
+			}
+		case "refund_usd":
+			if ev.Decimal != "" {
+				t.Errorf("Decimal = %q, want none for inexact events", ev.Decimal)
+			}
+		}
+	})
+}
+
+func TestSummer_ExactDecimals(t *testing.T) {
+	s := NewSummer(256).Exact(map[string]int{"invoice_usd": 2})
+	for _, d := range []string{"10.05", "0.10", "-3.015", "7"} {
+		if err := s.Add("billing", "checkout", &pb.Event{Name: "invoice_usd", Decimal: d}); err != nil {
+			t.Fatalf("Add(%q) = %v", d, err)
+		}
+	}
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		if want := "14.13"; ev.Decimal != want {
+			t.Errorf("Decimal = %q, want %q", ev.Decimal, want)
+		}
+	})
+}
+
+func TestSummer_ExactLargeSums(t *testing.T) {
+	s := NewSummer(256).Exact(map[string]int{"invoice_usd": 2})
+	for i := 0; i < 3; i++ {
+		if err := s.Add("billing", "checkout", &pb.Event{Name: "invoice_usd", Decimal: "92233720368547758.07"}); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		if want := "276701161105643274.21"; ev.Decimal != want {
+			t.Errorf("Decimal = %q, want %q", ev.Decimal, want)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	scales := map[string]int{"invoice_usd": 2}
+	tests := []struct {
+		ev      *pb.Event
+		wantErr bool
+	}{
+		{ev: &pb.Event{Name: "invoice_usd", Decimal: "10.05"}},
+		{ev: &pb.Event{Name: "invoice_usd", Decimal: "99999999999999999999"}, wantErr: true},
+		{ev: &pb.Event{Name: "invoice_usd", Value: 1e18}, wantErr: true},
+		{ev: &pb.Event{Name: "invoice_usd", Value: 1e16, SampleRate: 0.001}, wantErr: true},
+		{ev: &pb.Event{Name: "refund_usd", Decimal: "10.05"}},
+		{ev: &pb.Event{Name: "customers", Kind: pb.Kind_DISTINCT, Sketch: NewHLL().Bytes()}},
+		{ev: &pb.Event{Name: "customers", Kind: pb.Kind_DISTINCT, Sketch: []byte{1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := Verify(tt.ev, scales)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Verify(%v) = %v, wantErr %v", tt.ev, err, tt.wantErr)
+		}
+		// Events that pass Verify are added without errors.
+		if addErr := NewSummer(0).Exact(scales).Add("billing", "checkout", tt.ev); err == nil && addErr != nil {
+			t.Errorf("Add(%v) = %v after Verify passed", tt.ev, addErr)
+		}
+	}
+}
+
+func TestSummer_InexactDecimals(t *testing.T) {
+	s := NewSummer(256)
+	for _, d := range []string{"10.25", "-3.5"} {
+		if err := s.Add("billing", "checkout", &pb.Event{Name: "refund_usd", Decimal: d}); err != nil {
+			t.Fatalf("Add(%q) = %v", d, err)
+		}
+	}
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		if ev.Value != 6.75 || ev.Decimal != "" {
+			t.Errorf("Value, Decimal = %v, %q; want 6.75, none", ev.Value, ev.Decimal)
+		}
+	})
+}
+
+func TestSummer_Sampled(t *testing.T) {
+	s := NewSummer(256)
+	for i := 0; i < 3; i++ {
+		s.Add("cluster1", "origin_1", &pb.Event{Name: "sql_count", Value: 1, SampleRate: 0.01})
+	}
+	s.Add("cluster1", "origin_1", &pb.Event{Name: "sql_count", Value: 1})
+	s.Add("cluster1", "origin_1", &pb.Event{Name: "sql_count", Value: 50, Count: 50})
+
+	s.ForEach(func(target, origin string, ev *pb.Event) {
+		if ev.Value != 351 {
+			t.Errorf("Value = %v, want 351", ev.Value)
+		}
+		if ev.Count != 54 {
+			t.Errorf("Count = %v, want 54", ev.Count)
+		}
+	})
+}
+
 func BenchmarkSummer(b *testing.B) {
 	const (
 		originCardinality = 10
@@ -130,7 +314,7 @@ func BenchmarkSummer(b *testing.B) {
 }
 
 func (s *Summer) exists(target, origin string, ev *pb.Event) bool {
-	key := key(target, origin, ev.Name)
+	key := key(target, origin, ev.Kind, ev.Name)
 	v, ok := s.events[key]
 	if !ok {
 		return false
@@ -0,0 +1,94 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxScale is the maximum number of decimal places
+// of fixed-point decimals.
+const maxScale = 12
+
+// ParseDecimal parses a decimal string such as "-12.0503" into
+// units of 10^-scale. Digits beyond the scale are rounded half
+// away from zero.
+func ParseDecimal(s string, scale int) (int64, error) {
+	if scale < 0 || scale > maxScale {
+		return 0, fmt.Errorf("decimal scale %d is out of range", scale)
+	}
+	neg := strings.HasPrefix(s, "-")
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 {
+		return 0, fmt.Errorf("malformed decimal %q", s)
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("malformed decimal %q", s)
+	}
+
+	var roundUp bool
+	if len(frac) > scale {
+		roundUp = frac[scale] >= '5'
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+	units, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("decimal %q is out of range", s)
+	}
+	if roundUp {
+		if units == math.MaxInt64 {
+			return 0, fmt.Errorf("decimal %q is out of range", s)
+		}
+		units++
+	}
+	if neg {
+		units = -units
+	}
+	return units, nil
+}
+
+// FloatToDecimal rounds v to units of 10^-scale.
+func FloatToDecimal(v float64, scale int) (int64, error) {
+	if scale < 0 || scale > maxScale {
+		return 0, fmt.Errorf("decimal scale %d is out of range", scale)
+	}
+	units := math.Round(v * math.Pow10(scale))
+	if math.IsNaN(units) || units >= math.MaxInt64 || units <= math.MinInt64 {
+		return 0, fmt.Errorf("value %v is out of range", v)
+	}
+	return int64(units), nil
+}
+
+// FormatDecimal formats units of 10^-scale as a decimal string.
+func FormatDecimal(units *big.Int, scale int) string {
+	s := new(big.Int).Abs(units).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if units.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// decimalValue returns units of 10^-scale as a float.
+func decimalValue(units *big.Int, scale int) float64 {
+	v, _ := new(big.Rat).SetFrac(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).Float64()
+	return v
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
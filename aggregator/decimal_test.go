@@ -0,0 +1,60 @@
+package aggregator
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s       string
+		scale   int
+		want    int64
+		wantErr bool
+	}{
+		{s: "0", scale: 2, want: 0},
+		{s: "12.5", scale: 2, want: 1250},
+		{s: "-12.5", scale: 2, want: -1250},
+		{s: "+1.005", scale: 2, want: 101},
+		{s: "1.004", scale: 2, want: 100},
+		{s: "7.", scale: 0, want: 7},
+		{s: "0.000001", scale: 6, want: 1},
+		{s: "", scale: 2, wantErr: true},
+		{s: ".5", scale: 2, wantErr: true},
+		{s: "1e3", scale: 2, wantErr: true},
+		{s: "--1", scale: 2, wantErr: true},
+		{s: "99999999999999999999", scale: 2, wantErr: true},
+		{s: "1", scale: 13, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.s, tt.scale)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDecimal(%q, %d) error = %v, wantErr %v", tt.s, tt.scale, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDecimal(%q, %d) = %v, want %v", tt.s, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		units int64
+		scale int
+		want  string
+	}{
+		{units: 0, scale: 0, want: "0"},
+		{units: 0, scale: 2, want: "0.00"},
+		{units: 5, scale: 3, want: "0.005"},
+		{units: -1250, scale: 2, want: "-12.50"},
+		{units: 100000000000, scale: 6, want: "100000.000000"},
+		{units: math.MinInt64, scale: 0, want: "-9223372036854775808"},
+	}
+	for _, tt := range tests {
+		if got := FormatDecimal(big.NewInt(tt.units), tt.scale); got != tt.want {
+			t.Errorf("FormatDecimal(%d, %d) = %q, want %q", tt.units, tt.scale, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package aggregator
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+
+	"github.com/mykodev/myko/internal/hashing"
+)
+
+// hllPrecision is the number of bits used to pick a register.
+// 2^12 registers give a standard error of about 1.6%.
+const hllPrecision = 12
+
+const hllRegisters = 1 << hllPrecision
+
+// hllMaxRank is the largest rank an ID can have, the number
+// of bits left after the register index plus one.
+const hllMaxRank = 64 - hllPrecision + 1
+
+// HLL is a HyperLogLog sketch that approximates the number
+// of distinct IDs inserted into it. Sketches are mergeable,
+// a merged sketch counts the union of the merged IDs.
+type HLL struct {
+	registers []uint8
+}
+
+func NewHLL() *HLL {
+	return &HLL{registers: make([]uint8, hllRegisters)}
+}
+
+// ParseHLL parses a sketch serialized with Bytes.
+func ParseHLL(b []byte) (*HLL, error) {
+	if len(b) != hllRegisters+1 || b[0] != hllPrecision {
+		return nil, errors.New("malformed HyperLogLog sketch")
+	}
+	h := NewHLL()
+	for i, v := range b[1:] {
+		if v > hllMaxRank {
+			return nil, errors.New("malformed HyperLogLog sketch")
+		}
+		h.registers[i] = v
+	}
+	return h, nil
+}
+
+func (h *HLL) Insert(id string) {
+	// Hashes need to be stable across processes
+	// for sketches to be mergeable.
+	x := hashing.String(id)
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *HLL) Merge(other *HLL) {
+	for i, v := range other.registers {
+		if v > h.registers[i] {
+			h.registers[i] = v
+		}
+	}
+}
+
+// Estimate returns the approximate number of distinct IDs.
+func (h *HLL) Estimate() uint64 {
+	const m = float64(hllRegisters)
+
+	var sum float64
+	var zeros int
+	for _, v := range h.registers {
+		sum += 1 / float64(uint64(1)<<v)
+		if v == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Bytes serializes the sketch. The first byte is the
+// precision, followed by the registers.
+func (h *HLL) Bytes() []byte {
+	b := make([]byte, 0, hllRegisters+1)
+	b = append(b, hllPrecision)
+	return append(b, h.registers...)
+}
@@ -0,0 +1,69 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHLL(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct int
+		repeat   int
+	}{
+		{name: "empty", distinct: 0, repeat: 1},
+		{name: "small", distinct: 10, repeat: 3},
+		{name: "medium", distinct: 5000, repeat: 2},
+		{name: "large", distinct: 200000, repeat: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHLL()
+			for r := 0; r < tt.repeat; r++ {
+				for i := 0; i < tt.distinct; i++ {
+					h.Insert(fmt.Sprintf("customer_%d", i))
+				}
+			}
+			assertEstimate(t, h, tt.distinct)
+		})
+	}
+}
+
+func TestHLL_Merge(t *testing.T) {
+	a, b := NewHLL(), NewHLL()
+	for i := 0; i < 3000; i++ {
+		a.Insert(fmt.Sprintf("customer_%d", i))
+	}
+	for i := 2000; i < 6000; i++ {
+		b.Insert(fmt.Sprintf("customer_%d", i))
+	}
+
+	parsed, err := ParseHLL(b.Bytes())
+	if err != nil {
+		t.Fatalf("ParseHLL() = %v", err)
+	}
+	a.Merge(parsed)
+	assertEstimate(t, a, 6000)
+}
+
+func TestParseHLL_Malformed(t *testing.T) {
+	if _, err := ParseHLL([]byte{hllPrecision, 1, 2}); err == nil {
+		t.Errorf("ParseHLL() = nil error, want error")
+	}
+	b := NewHLL().Bytes()
+	b[1] = hllMaxRank + 1
+	if _, err := ParseHLL(b); err == nil {
+		t.Errorf("ParseHLL() = nil error for a rank above the maximum, want error")
+	}
+}
+
+func assertEstimate(t *testing.T, h *HLL, want int) {
+	t.Helper()
+
+	// Allow 3 standard errors.
+	tolerance := 3 * 1.04 / math.Sqrt(hllRegisters) * float64(want)
+	if got := h.Estimate(); math.Abs(float64(got)-float64(want)) > tolerance {
+		t.Errorf("Estimate() = %v, want %v±%.0f", got, want, tolerance)
+	}
+}
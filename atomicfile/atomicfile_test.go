@@ -0,0 +1,31 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state", "checkpoints.json")
+	for _, v := range []map[string]int{{"a.log": 1}, {"a.log": 2}} {
+		if err := WriteJSON(path, v); err != nil {
+			t.Fatalf("WriteJSON() = %v", err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"a.log":2}`; got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d files, want no temporary files left", len(entries))
+	}
+}
@@ -0,0 +1,323 @@
+// Package client records events from Go programs. Events are
+// aggregated in the process as the server aggregates them and
+// sent in the background, so recording is cheap enough for hot
+// paths.
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mykodev/myko/aggregator"
+	"github.com/mykodev/myko/format"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Inserter inserts entries, e.g. the Twirp
+// or the gRPC client of the service.
+type Inserter interface {
+	InsertEvents(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error)
+}
+
+type Options struct {
+	// Origin is the origin of the events recorded with
+	// contexts without an origin. Such events are dropped
+	// if not set.
+	Origin string
+
+	// FlushInterval is how often the aggregated events are
+	// sent. Events are batched by windows of the interval
+	// aligned to the wall clock and timestamped with the start
+	// of their window, so the interval needs to be well below
+	// the tolerance of the server. Defaults to 10 seconds.
+	FlushInterval time.Duration
+
+	// MaxEvents is the number of aggregated events that
+	// triggers a flush before the interval. Defaults to 1024.
+	MaxEvents int
+
+	// MaxPendingBatches is the number of batches kept while
+	// they wait to be sent, e.g. while the server is slow or
+	// down. Batches are dropped when there are more.
+	// Defaults to 4.
+	MaxPendingBatches int
+
+	// RootOrigin attributes events to the root origin of the
+	// call chain alongside the origin, as "<root>/<origin>",
+	// if a Propagator with Root has propagated a root origin
+	// different than the origin.
+	RootOrigin bool
+
+	// Exact maps event names to the number of decimal places
+	// they are summed with, as configured on the server.
+	Exact map[string]int
+}
+
+// Stats are the numbers of events recorded by a client.
+type Stats struct {
+	Recorded uint64
+	Sent     uint64
+
+	// Dropped events are the events without an origin and the
+	// events that couldn't be sent or were rejected by the server.
+	Dropped uint64
+}
+
+type Client struct {
+	inserter Inserter
+	opts     Options
+
+	mu     sync.Mutex // guards summer, start and closed
+	summer *aggregator.Summer
+	start  time.Time // start of the window of summer
+	closed bool
+
+	batches chan *batch
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	recorded atomic.Uint64
+	sent     atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+type batch struct {
+	start  time.Time
+	summer *aggregator.Summer
+}
+
+// Dial returns a client that sends events to the myko
+// server at addr, e.g. "http://localhost:6959".
+func Dial(addr string, opts Options) *Client {
+	return New(pb.NewServiceProtobufClient(addr, &http.Client{}), opts)
+}
+
+// New returns a client that sends events with the inserter.
+// Clients need to be closed to send the last events.
+func New(inserter Inserter, opts Options) *Client {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	if opts.MaxEvents <= 0 {
+		opts.MaxEvents = 1024
+	}
+	if opts.MaxPendingBatches <= 0 {
+		opts.MaxPendingBatches = 4
+	}
+	c := &Client{
+		inserter: inserter,
+		opts:     opts,
+		summer:   aggregator.NewSummer(opts.MaxEvents).Exact(opts.Exact),
+		batches:  make(chan *batch, opts.MaxPendingBatches),
+		done:     make(chan struct{}),
+	}
+	c.wg.Add(2)
+	go c.tick()
+	go c.send()
+	return c
+}
+
+// Record adds value to the event of the target, attributed to
+// the origin of ctx. Values of the same target, origin and event
+// are summed up until they are sent.
+func (c *Client) Record(ctx context.Context, target, event string, value float64) {
+	c.record(ctx, target, &pb.Event{Name: event, Value: value})
+}
+
+func (c *Client) record(ctx context.Context, target string, ev *pb.Event) {
+	c.recorded.Add(1)
+	origin := c.origin(ctx)
+	if origin == "" || target == "" {
+		c.dropped.Add(1)
+		return
+	}
+	ev.Name = format.Name(ev.Name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		c.dropped.Add(1)
+		return
+	}
+	start := time.Now().Truncate(c.opts.FlushInterval)
+	if c.summer.Size() > 0 && !start.Equal(c.start) {
+		// Don't count the event in the previous window.
+		c.enqueue(c.rotate())
+	}
+	if c.summer.Size() == 0 {
+		c.start = start
+	}
+	if err := c.summer.Add(format.Name(target), format.Name(origin), ev); err != nil {
+		c.dropped.Add(1)
+		return
+	}
+	if c.summer.Size() >= c.opts.MaxEvents {
+		c.enqueue(c.rotate())
+	}
+}
+
+func (c *Client) origin(ctx context.Context) string {
+	origin := Origin(ctx)
+	if origin == "" {
+		return c.opts.Origin
+	}
+	if root := RootOrigin(ctx); c.opts.RootOrigin && root != "" && root != origin {
+		return root + "/" + origin
+	}
+	return origin
+}
+
+// Stats returns the numbers of events recorded so far.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Recorded: c.recorded.Load(),
+		Sent:     c.sent.Load(),
+		Dropped:  c.dropped.Load(),
+	}
+}
+
+// Flush sends the aggregated events in the background.
+func (c *Client) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.enqueue(c.rotate())
+	}
+}
+
+// Close stops the background flushes and sends the
+// remaining events. Events recorded later are dropped.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	last := c.rotate()
+	c.mu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+	return c.insert(last)
+}
+
+// rotate returns the aggregated events as a batch and starts
+// a new one. The caller needs to hold c.mu.
+func (c *Client) rotate() *batch {
+	if c.summer.Size() == 0 {
+		return nil
+	}
+	b := &batch{start: c.start, summer: c.summer}
+	c.summer = aggregator.NewSummer(c.opts.MaxEvents).Exact(c.opts.Exact)
+	return b
+}
+
+// enqueue queues the batch to be sent, or drops it if there
+// are too many pending batches. The caller needs to hold c.mu.
+func (c *Client) enqueue(b *batch) {
+	if b == nil {
+		return
+	}
+	select {
+	case c.batches <- b:
+	default:
+		c.dropped.Add(b.events())
+	}
+}
+
+// tick flushes the events at the end of every window.
+func (c *Client) tick() {
+	defer c.wg.Done()
+	timer := time.NewTimer(c.untilNextWindow())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			c.Flush()
+			timer.Reset(c.untilNextWindow())
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) untilNextWindow() time.Duration {
+	now := time.Now()
+	return now.Truncate(c.opts.FlushInterval).Add(c.opts.FlushInterval).Sub(now)
+}
+
+// send sends the pending batches until the client is closed.
+func (c *Client) send() {
+	defer c.wg.Done()
+	for {
+		select {
+		case b := <-c.batches:
+			c.insert(b)
+		case <-c.done:
+			// Send the batches queued before closing.
+			for {
+				select {
+				case b := <-c.batches:
+					c.insert(b)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// insert sends the batch. Events of failed batches are dropped,
+// retries would delay the next batches.
+func (c *Client) insert(b *batch) error {
+	if b == nil {
+		return nil
+	}
+	ts := timestamppb.New(b.start)
+	byKey := make(map[[2]string]*pb.Entry)
+	var entries []*pb.Entry
+	b.summer.ForEach(func(target, origin string, ev *pb.Event) {
+		e, ok := byKey[[2]string{target, origin}]
+		if !ok {
+			e = &pb.Entry{Target: target, Origin: origin, Timestamp: ts}
+			byKey[[2]string{target, origin}] = e
+			entries = append(entries, e)
+		}
+		e.Events = append(e.Events, ev)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.FlushInterval)
+	defer cancel()
+	resp, err := c.inserter.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries, Partial: true})
+	if err != nil {
+		c.dropped.Add(b.events())
+		return err
+	}
+	var rejected uint64
+	for _, r := range resp.Rejections {
+		if int(r.Index) >= len(entries) {
+			continue
+		}
+		for _, ev := range entries[r.Index].Events {
+			rejected += ev.Count
+		}
+	}
+	c.dropped.Add(rejected)
+	c.sent.Add(b.events() - rejected)
+	return nil
+}
+
+// events returns the number of recorded events in the batch.
+func (b *batch) events() uint64 {
+	var n uint64
+	b.summer.ForEach(func(_, _ string, ev *pb.Event) {
+		n += ev.Count
+	})
+	return n
+}
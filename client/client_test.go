@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/mykotest"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestClient(t *testing.T) {
+	inserter := &mykotest.Service{}
+	c := New(inserter, Options{})
+
+	ctx := WithOrigin(context.Background(), "site_navbar")
+	c.Record(ctx, "mysql", "query_count", 1)
+	c.Record(ctx, "mysql", "query_count", 1)
+	c.Record(ctx, "mysql", "query_latency_ms", 10.5)
+	c.Record(context.Background(), "mysql", "query_count", 1) // no origin
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	c.Record(ctx, "mysql", "query_count", 1) // closed
+
+	if len(inserter.Entries()) != 1 {
+		t.Fatalf("len(entries) = %v, want 1", len(inserter.Entries()))
+	}
+	e := inserter.Entries()[0]
+	if e.Target != "mysql" || e.Origin != "site_navbar" || e.Timestamp == nil {
+		t.Errorf("entry = %v", e)
+	}
+	for _, ev := range e.Events {
+		if ev.Name == "query_count" && (ev.Value != 2 || ev.Count != 2) {
+			t.Errorf("query_count = %v (%d events), want 2 (2 events)", ev.Value, ev.Count)
+		}
+	}
+	want := Stats{Recorded: 5, Sent: 3, Dropped: 2}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	inserter := &mykotest.Service{}
+	inserter.Fail(errors.New("connection refused"))
+	c := New(inserter, Options{Origin: "worker", MaxEvents: 2, MaxPendingBatches: 1})
+	for i := 0; i < 100; i++ {
+		c.Record(context.Background(), "mysql", "query_count", 1)
+		c.Record(context.Background(), "redis", "query_count", 1)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() = %v, want nil with nothing left to send", err)
+	}
+	if got := c.Stats(); got.Dropped != 200 || got.Sent != 0 {
+		t.Errorf("Stats() = %+v, want all 200 events dropped", got)
+	}
+}
+
+func TestClient_Windows(t *testing.T) {
+	inserter := &mykotest.Service{}
+	interval := 50 * time.Millisecond
+	c := New(inserter, Options{Origin: "worker", FlushInterval: interval})
+	c.Record(context.Background(), "mysql", "query_count", 1)
+	time.Sleep(c.untilNextWindow())
+	c.Record(context.Background(), "mysql", "query_count", 1)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	entries := inserter.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %v, want 2", len(entries))
+	}
+	first, second := entries[0].Timestamp.AsTime(), entries[1].Timestamp.AsTime()
+	if !first.Equal(first.Truncate(interval)) || second.Sub(first) != interval {
+		t.Errorf("timestamps = %v, %v; want the starts of consecutive windows", first, second)
+	}
+}
+
+func TestClient_Rejections(t *testing.T) {
+	inserter := inserterFunc(func(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error) {
+		return &pb.InsertEventsResponse{Rejections: []*pb.Rejection{
+			{Index: 0, Reason: "entry is too old"},
+			{Index: 5, Reason: "out of range"},
+		}}, nil
+	})
+	c := New(inserter, Options{Origin: "worker"})
+	c.Record(context.Background(), "mysql", "query_count", 1)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if got, want := c.Stats(), (Stats{Recorded: 1, Dropped: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+type inserterFunc func(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error)
+
+func (f inserterFunc) InsertEvents(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error) {
+	return f(ctx, req)
+}
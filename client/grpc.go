@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor attributes unary RPCs to their full
+// method name, e.g. "/myko.Service/Query", unless they already
+// carry an origin. RPCs are handled labeled with their origin
+// as by Do.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if Origin(ctx) == "" {
+			ctx = WithOrigin(ctx, info.FullMethod)
+		}
+		return handleUnary(ctx, req, handler)
+	}
+}
+
+// StreamServerInterceptor attributes streaming RPCs to their
+// full method name, unless they already carry an origin. RPCs
+// are handled labeled with their origin as by Do.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		if Origin(ctx) == "" {
+			ctx = WithOrigin(ctx, info.FullMethod)
+		}
+		return handleStream(ctx, srv, ss, handler)
+	}
+}
+
+// handleUnary handles req with ctx labeled with its origin.
+func handleUnary(ctx context.Context, req any, handler grpc.UnaryHandler) (resp any, err error) {
+	Do(ctx, func(ctx context.Context) {
+		resp, err = handler(ctx, req)
+	})
+	return resp, err
+}
+
+// handleStream handles ss with ctx labeled with its origin.
+func handleStream(ctx context.Context, srv any, ss grpc.ServerStream, handler grpc.StreamHandler) (err error) {
+	Do(ctx, func(ctx context.Context) {
+		err = handler(srv, &originStream{ServerStream: ss, ctx: ctx})
+	})
+	return err
+}
+
+type originStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *originStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Handler serves requests with mux and attributes them to the
+// pattern that matches the request, e.g. "/users/". Requests
+// that don't match a pattern or already carry an origin, e.g.
+// propagated by the caller, keep the origin of their context.
+func Handler(mux *http.ServeMux) http.Handler {
+	return Middleware(mux, func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	})
+}
+
+// Middleware attributes the requests served by next to the
+// origin returned by fn, e.g. the route matched by a router.
+// If the request already carries an origin or fn returns an
+// empty origin, the request keeps its origin. Requests are
+// served labeled with their origin as by Do.
+func Middleware(next http.Handler, fn func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if Origin(ctx) == "" {
+			if origin := fn(r); origin != "" {
+				ctx = WithOrigin(ctx, origin)
+			}
+		}
+		serve(ctx, next, w, r)
+	})
+}
+
+// serve serves r with ctx labeled with its origin.
+func serve(ctx context.Context, h http.Handler, w http.ResponseWriter, r *http.Request) {
+	Do(ctx, func(ctx context.Context) {
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,246 @@
+package mykosql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+)
+
+// wrappedConn records the queries executed on the connection.
+// The optional interfaces of the driver are implemented with
+// the fallbacks database/sql uses when they are missing.
+type wrappedConn struct {
+	driver.Conn
+	r *recorder
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = c.r.comment(ctx, query)
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedStmt{Stmt: stmt, conn: c.Conn, r: c.r}, nil
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip // database/sql prepares the statement
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, c.r.comment(ctx, query), args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.r.record(ctx, start, rowsAffected(res, err))
+	return res, err
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, c.r.comment(ctx, query), args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.r.recordQuery(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedRows{Rows: rows, ctx: ctx, r: c.r}, nil
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("mykosql: driver doesn't support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip // the default conversion
+}
+
+type wrappedStmt struct {
+	driver.Stmt
+	conn driver.Conn
+	r    *recorder
+}
+
+func (s *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	s.r.record(ctx, start, rowsAffected(res, err))
+	return res, err
+}
+
+func (s *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	s.r.recordQuery(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedRows{Rows: rows, ctx: ctx, r: s.r}, nil
+}
+
+func (s *wrappedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	if n, ok := s.conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// wrappedRows counts the rows read and records
+// them once the rows are closed.
+type wrappedRows struct {
+	driver.Rows
+	ctx context.Context
+	r   *recorder
+	n   int64
+}
+
+func (r *wrappedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.n++
+	}
+	return err
+}
+
+func (r *wrappedRows) Close() error {
+	r.r.recordRows(r.ctx, r.n)
+	return r.Rows.Close()
+}
+
+func (r *wrappedRows) HasNextResultSet() bool {
+	if s, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return s.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *wrappedRows) NextResultSet() error {
+	if s, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return s.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *wrappedRows) ColumnTypeScanType(index int) reflect.Type {
+	if c, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return c.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *wrappedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if c, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return c.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *wrappedRows) ColumnTypeLength(index int) (int64, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return c.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *wrappedRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return c.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *wrappedRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return c.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+func rowsAffected(res driver.Result, err error) int64 {
+	if err != nil || res == nil {
+		return 0
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("mykosql: driver doesn't support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
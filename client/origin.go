@@ -0,0 +1,36 @@
+package client
+
+import "context"
+
+type originKey struct{}
+
+type rootOriginKey struct{}
+
+// WithOrigin returns a context carrying the origin the events
+// recorded with the context are attributed to, e.g.
+//
+//	ctx = client.WithOrigin(ctx, "site_navbar")
+//
+// The origin of incoming requests is set by Handler, Middleware,
+// the gRPC server interceptors and Propagator.
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// Origin returns the origin carried by ctx, if any.
+// Record uses it to attribute the events.
+func Origin(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
+
+func withRootOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, rootOriginKey{}, origin)
+}
+
+// RootOrigin returns the origin of the request at the first
+// service of the call chain, if propagated with Propagator.Root.
+func RootOrigin(ctx context.Context) string {
+	origin, _ := ctx.Value(rootOriginKey{}).(string)
+	return origin
+}
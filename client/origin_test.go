@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestHandler(t *testing.T) {
+	var got, label string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		got = Origin(r.Context())
+		label, _ = pprof.Label(r.Context(), originLabel)
+	})
+	Handler(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	if got != "/users/" || label != "/users/" {
+		t.Errorf("Origin() = %q, label = %q; want /users/", got, label)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/myko.Service/Query"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		label, _ := pprof.Label(ctx, originLabel)
+		return [2]string{Origin(ctx), label}, nil
+	}
+	got, err := UnaryServerInterceptor()(context.Background(), nil, info, handler)
+	if want := [2]string{info.FullMethod, info.FullMethod}; err != nil || got != want {
+		t.Errorf("origin and label = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestPropagator(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Propagator
+	}{
+		{"baggage", Propagator{Root: true}},
+		{"header", Propagator{Header: "X-Myko-Origin", Root: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The frontend calls the users service on behalf of
+			// site_navbar, and the users service calls the
+			// database in a background job.
+			h := http.Header{}
+			h.Set("Baggage", "userId=alice")
+			tt.p.Inject(WithOrigin(context.Background(), "site_navbar"), h)
+
+			ctx := tt.p.Extract(context.Background(), h)
+			if got := Origin(ctx); got != "site_navbar" {
+				t.Errorf("Origin() = %q, want site_navbar", got)
+			}
+			ctx = WithOrigin(ctx, "refresh_job")
+
+			h = http.Header{}
+			tt.p.Inject(ctx, h)
+			ctx = tt.p.Extract(context.Background(), h)
+			if got, root := Origin(ctx), RootOrigin(ctx); got != "refresh_job" || root != "site_navbar" {
+				t.Errorf("Origin(), RootOrigin() = %q, %q; want refresh_job, site_navbar", got, root)
+			}
+		})
+	}
+
+	h := http.Header{}
+	h.Set("Baggage", "userId=alice")
+	Propagator{}.Inject(WithOrigin(context.Background(), "site navbar"), h)
+	if got, want := h.Get("Baggage"), "userId=alice,myko.origin=site%20navbar"; got != want {
+		t.Errorf("baggage = %q, want %q", got, want)
+	}
+}
+
+func TestPropagator_Hosts(t *testing.T) {
+	var got []string
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		got = append(got, r.Header.Get("Baggage"))
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	transport := Propagator{Hosts: []string{"users", ".svc.cluster.local"}}.Transport(base)
+
+	ctx := WithOrigin(context.Background(), "site_navbar")
+	for _, url := range []string{"http://users:8080/", "http://orders.svc.cluster.local/", "https://api.example.com/"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"myko.origin=site_navbar", "myko.origin=site_navbar", ""}
+	if len(got) != len(want) {
+		t.Fatalf("baggage = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("baggage of request %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/mykodev/myko/internal/wire"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// CPU profiles are gzipped protobuf Profiles. Only the fields
+// needed to sum the CPU time by label are decoded:
+//
+//	message Profile {
+//		repeated ValueType sample_type = 1;
+//		repeated Sample sample = 2;
+//		repeated string string_table = 6;
+//	}
+//	message ValueType { int64 type = 1; int64 unit = 2; }
+//	message Sample { repeated int64 value = 2; repeated Label label = 3; }
+//	message Label { int64 key = 1; int64 str = 2; }
+//
+// Types, units, keys and strs are indexes of the string table.
+
+var errMalformedProfile = errors.New("malformed CPU profile")
+
+type profileSample struct {
+	values []int64
+	labels map[int64]int64 // key to str
+}
+
+// cpuByLabel returns the CPU time in nanoseconds of the samples
+// of the profile by the value of their label with the given key.
+// Samples without the label are summed up under "".
+func cpuByLabel(profile []byte, key string) (map[string]int64, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(profile))
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []int64 // type and unit pairs
+	var samples []profileSample
+	var strs []string
+	err = wire.ParseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			var t, u int64
+			err := wire.ParseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ == protowire.VarintType {
+					x, _ := protowire.ConsumeVarint(v)
+					switch num {
+					case 1:
+						t = int64(x)
+					case 2:
+						u = int64(x)
+					}
+				}
+				return nil
+			})
+			types = append(types, t, u)
+			return err
+		case 2:
+			s, err := parseSample(v)
+			samples = append(samples, s)
+			return err
+		case 6:
+			strs = append(strs, string(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) string {
+		if i < 0 || i >= int64(len(strs)) {
+			return ""
+		}
+		return strs[i]
+	}
+	cpu := -1
+	for i := 0; i < len(types); i += 2 {
+		if str(types[i]) == "cpu" && str(types[i+1]) == "nanoseconds" {
+			cpu = i / 2
+		}
+	}
+	if cpu < 0 {
+		return nil, errors.New("profile doesn't contain CPU time")
+	}
+
+	byLabel := make(map[string]int64)
+	for _, s := range samples {
+		if cpu >= len(s.values) {
+			return nil, errMalformedProfile
+		}
+		var value string
+		for k, v := range s.labels {
+			if str(k) == key {
+				value = str(v)
+			}
+		}
+		byLabel[value] += s.values[cpu]
+	}
+	return byLabel, nil
+}
+
+func parseSample(b []byte) (profileSample, error) {
+	s := profileSample{labels: make(map[int64]int64)}
+	err := wire.ParseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 2 && typ == protowire.VarintType:
+			x, _ := protowire.ConsumeVarint(v)
+			s.values = append(s.values, int64(x))
+		case num == 2 && typ == protowire.BytesType: // packed
+			for len(v) > 0 {
+				x, n := protowire.ConsumeVarint(v)
+				if n < 0 {
+					return errMalformedProfile
+				}
+				s.values = append(s.values, int64(x))
+				v = v[n:]
+			}
+		case num == 3 && typ == protowire.BytesType:
+			var k, str int64
+			err := wire.ParseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ == protowire.VarintType {
+					x, _ := protowire.ConsumeVarint(v)
+					switch num {
+					case 1:
+						k = int64(x)
+					case 2:
+						str = int64(x)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.labels[k] = str
+		}
+		return nil
+	})
+	return s, err
+}
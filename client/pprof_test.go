@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/mykotest"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCPUByLabel(t *testing.T) {
+	// String table: "", samples, count, cpu, nanoseconds,
+	// myko_origin, site_navbar, checkout.
+	strs := []string{"", "samples", "count", "cpu", "nanoseconds", "myko_origin", "site_navbar", "checkout"}
+	valueType := func(typ, unit uint64) []byte {
+		b := protowire.AppendTag(nil, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, typ)
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		return protowire.AppendVarint(b, unit)
+	}
+	sample := func(cpu uint64, origin uint64) []byte {
+		var values []byte
+		values = protowire.AppendVarint(values, 1)
+		values = protowire.AppendVarint(values, cpu)
+		b := protowire.AppendTag(nil, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, values)
+		if origin > 0 {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.VarintType)
+			label = protowire.AppendVarint(label, 5)
+			label = protowire.AppendTag(label, 2, protowire.VarintType)
+			label = protowire.AppendVarint(label, origin)
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendBytes(b, label)
+		}
+		return b
+	}
+
+	var profile []byte
+	for _, vt := range [][]byte{valueType(1, 2), valueType(3, 4)} {
+		profile = protowire.AppendTag(profile, 1, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, vt)
+	}
+	for _, s := range [][]byte{sample(10e6, 6), sample(20e6, 6), sample(5e6, 7), sample(1e6, 0)} {
+		profile = protowire.AppendTag(profile, 2, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, s)
+	}
+	for _, s := range strs {
+		profile = protowire.AppendTag(profile, 6, protowire.BytesType)
+		profile = protowire.AppendString(profile, s)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(profile)
+	zw.Close()
+
+	got, err := cpuByLabel(buf.Bytes(), originLabel)
+	if err != nil {
+		t.Fatalf("cpuByLabel() = %v", err)
+	}
+	want := map[string]int64{"site_navbar": 30e6, "checkout": 5e6, "": 1e6}
+	if len(got) != len(want) {
+		t.Errorf("cpuByLabel() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("cpuByLabel()[%q] = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	inserter := &mykotest.Service{}
+	c := New(inserter, Options{})
+	p := &Profiler{Client: c, Target: "webserver", Duration: 200 * time.Millisecond, Interval: 400 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go Do(WithOrigin(ctx, "site_navbar"), func(ctx context.Context) {
+		for ctx.Err() == nil {
+			// Burn CPU on behalf of site_navbar.
+		}
+	})
+	if err := p.Run(ctx); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	var cpu float64
+	for _, e := range inserter.Entries() {
+		if e.Target != "webserver" || e.Origin != "site_navbar" {
+			t.Errorf("entry = %v/%v, want webserver/site_navbar", e.Target, e.Origin)
+		}
+		for _, ev := range e.Events {
+			if ev.Name != "cpu_seconds" {
+				t.Errorf("event = %v, want cpu_seconds", ev)
+			}
+			cpu += ev.Value
+		}
+	}
+	if cpu <= 0 {
+		t.Errorf("cpu_seconds of site_navbar = %v, want > 0", cpu)
+	}
+}
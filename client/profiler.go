@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"time"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// originLabel is the pprof label of the goroutines
+// running on behalf of an origin.
+const originLabel = "myko_origin"
+
+// Do calls f with the goroutine labeled with the origin of ctx,
+// so a Profiler attributes the CPU time f spends to the origin.
+// Goroutines started by f inherit the label.
+func Do(ctx context.Context, f func(ctx context.Context)) {
+	origin := Origin(ctx)
+	if origin == "" {
+		f(ctx)
+		return
+	}
+	pprof.Do(ctx, pprof.Labels(originLabel, origin), f)
+}
+
+// Profiler periodically takes CPU profiles of the process and
+// records the CPU time of the goroutines labeled by Do, Handler,
+// Middleware or the server interceptors as the cpu_seconds events
+// of the target, attributed to their origins.
+// CPU time of goroutines without an origin is attributed to the
+// client's default origin, or dropped if it's not set.
+//
+// Only a fraction of the time is profiled, which bounds the
+// overhead. The recorded values are scaled to estimate the CPU
+// time of the whole interval.
+type Profiler struct {
+	Client *Client
+
+	// Target is the target of the events, e.g. the service name.
+	Target string
+
+	// Duration is how long a profile is taken for.
+	// Defaults to 10 seconds.
+	Duration time.Duration
+
+	// Interval is how often a profile is taken. Defaults to
+	// a minute, i.e. a sixth of the time is profiled by default.
+	Interval time.Duration
+}
+
+// Run takes profiles until ctx is done. Intervals where the
+// process is already being profiled, e.g. by net/http/pprof,
+// are skipped as only one CPU profile can be taken at a time.
+func (p *Profiler) Run(ctx context.Context) error {
+	duration, interval := p.Duration, p.Interval
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if duration > interval {
+		duration = interval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.profile(ctx, duration, interval); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// profile profiles the process for the duration and records
+// the CPU time as a sample of the interval.
+func (p *Profiler) profile(ctx context.Context, duration, interval time.Duration) error {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil // another profile is being taken
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+	pprof.StopCPUProfile()
+	profiled := time.Since(start)
+
+	cpu, err := cpuByLabel(buf.Bytes(), originLabel)
+	if err != nil {
+		return err
+	}
+	rate := float64(profiled) / float64(interval)
+	if rate > 1 {
+		rate = 1
+	}
+	for origin, ns := range cpu {
+		octx := context.Background()
+		if origin != "" {
+			octx = WithOrigin(octx, origin)
+		}
+		p.Client.record(octx, p.Target, &pb.Event{
+			Name:       "cpu_seconds",
+			Value:      float64(ns) / float64(time.Second),
+			SampleRate: rate,
+		})
+	}
+	return nil
+}
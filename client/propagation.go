@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	baggageHeader = "Baggage"
+
+	originMember     = "myko.origin"
+	rootOriginMember = "myko.root_origin"
+)
+
+// Propagator carries the origin across services. It injects the
+// origin of the context into outgoing HTTP and gRPC calls and
+// extracts it from incoming ones, so the load a request causes
+// downstream is attributed to the origin of the caller rather
+// than the services in between. By default, the origin is
+// carried in the W3C baggage header as myko.origin.
+//
+// The handlers and the server interceptors of a propagator need
+// to run before the ones setting origins from routes or method
+// names, otherwise the latter take precedence.
+type Propagator struct {
+	// Header is the header carrying the origin instead of the
+	// baggage, e.g. X-Myko-Origin. The root origin is carried
+	// in the header with the -Root suffix.
+	Header string
+
+	// Root also propagates the origin of the first service in the
+	// call chain, which is kept even if the services in between
+	// attribute their requests to other origins. See RootOrigin.
+	Root bool
+
+	// Hosts are the hosts Transport injects the origins into
+	// requests for, e.g. the internal services, so origins are
+	// not sent to third parties. Hosts starting with a dot match
+	// their subdomains, e.g. ".svc.cluster.local". If empty, the
+	// origins are injected into requests for any host.
+	Hosts []string
+}
+
+// Inject sets the origins of ctx on the header.
+func (p Propagator) Inject(ctx context.Context, h http.Header) {
+	origin, root := p.origins(ctx)
+	if origin == "" {
+		return
+	}
+	if p.Header != "" {
+		h.Set(p.Header, origin)
+		if root != "" {
+			h.Set(p.Header+"-Root", root)
+		}
+		return
+	}
+
+	// Keep the members set by others, e.g. OpenTelemetry.
+	var members []string
+	for _, v := range h.Values(baggageHeader) {
+		for _, m := range strings.Split(v, ",") {
+			if key := baggageKey(m); key != "" && key != originMember && key != rootOriginMember {
+				members = append(members, strings.TrimSpace(m))
+			}
+		}
+	}
+	members = append(members, originMember+"="+url.PathEscape(origin))
+	if root != "" {
+		members = append(members, rootOriginMember+"="+url.PathEscape(root))
+	}
+	h.Set(baggageHeader, strings.Join(members, ","))
+}
+
+// Extract returns a context carrying the origins set on the header.
+func (p Propagator) Extract(ctx context.Context, h http.Header) context.Context {
+	var origin, root string
+	if p.Header != "" {
+		origin, root = h.Get(p.Header), h.Get(p.Header+"-Root")
+	} else {
+		for _, v := range h.Values(baggageHeader) {
+			for _, m := range strings.Split(v, ",") {
+				switch baggageKey(m) {
+				case originMember:
+					origin = baggageValue(m)
+				case rootOriginMember:
+					root = baggageValue(m)
+				}
+			}
+		}
+	}
+	if origin != "" {
+		ctx = WithOrigin(ctx, origin)
+	}
+	if p.Root && root != "" {
+		ctx = withRootOrigin(ctx, root)
+	}
+	return ctx
+}
+
+// origins returns the origins of ctx to propagate. The origin
+// of a request at the first service is the root origin.
+func (p Propagator) origins(ctx context.Context) (origin, root string) {
+	origin = Origin(ctx)
+	if !p.Root || origin == "" {
+		return origin, ""
+	}
+	if root = RootOrigin(ctx); root == "" {
+		root = origin
+	}
+	return origin, root
+}
+
+// Handler extracts the origins of the requests served by next.
+// Requests are served labeled with their origin as by Do.
+//
+// The origins are trusted as sent, so any caller can attribute
+// its requests to any origin. Only extract origins from trusted
+// callers, e.g. serve external requests without the handler.
+func (p Propagator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve(p.Extract(r.Context(), r.Header), next, w, r)
+	})
+}
+
+// Transport injects the origins of the requests sent with base
+// to the hosts of the propagator. If base is nil,
+// http.DefaultTransport is used.
+func (p Propagator) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if !p.matchHost(r.URL.Hostname()) {
+			return base.RoundTrip(r)
+		}
+		// Round trippers must not modify the request.
+		r = r.Clone(r.Context())
+		p.Inject(r.Context(), r.Header)
+		return base.RoundTrip(r)
+	})
+}
+
+// matchHost reports whether the origins are injected
+// into requests for host.
+func (p Propagator) matchHost(host string) bool {
+	if len(p.Hosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, h := range p.Hosts {
+		h = strings.ToLower(h)
+		if host == h || (strings.HasPrefix(h, ".") && strings.HasSuffix(host, h)) {
+			return true
+		}
+	}
+	return false
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// UnaryServerInterceptor extracts the origins of unary RPCs.
+// RPCs are handled labeled with their origin as by Do.
+func (p Propagator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handleUnary(p.extractIncoming(ctx), req, handler)
+	}
+}
+
+// StreamServerInterceptor extracts the origins of streaming RPCs.
+// RPCs are handled labeled with their origin as by Do.
+func (p Propagator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handleStream(p.extractIncoming(ss.Context()), srv, ss, handler)
+	}
+}
+
+// UnaryClientInterceptor injects the origins into unary RPCs.
+func (p Propagator) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(p.injectOutgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor injects the origins into streaming RPCs.
+func (p Propagator) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(p.injectOutgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// extractIncoming extracts the origins from the incoming
+// metadata. Metadata keys are lower case HTTP header names.
+func (p Propagator) extractIncoming(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	h := make(http.Header, len(md))
+	for k, v := range md {
+		h[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	return p.Extract(ctx, h)
+}
+
+func (p Propagator) injectOutgoing(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	h := make(http.Header, len(md))
+	for k, v := range md {
+		h[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	p.Inject(ctx, h)
+
+	md = md.Copy()
+	for k, v := range h {
+		md.Set(k, v...)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func baggageKey(member string) string {
+	key, _, _ := strings.Cut(member, "=")
+	return strings.TrimSpace(key)
+}
+
+// baggageValue returns the decoded value of the member
+// without its properties.
+func baggageValue(member string) string {
+	_, v, _ := strings.Cut(member, "=")
+	v, _, _ = strings.Cut(v, ";")
+	v, err := url.PathUnescape(strings.TrimSpace(v))
+	if err != nil {
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport records the requests sent with its base round
+// tripper as events of the target the requests are sent to,
+// attributed to the origin of the request context:
+//
+//	http_request_count, the number of requests
+//	http_request_latency_ms, the time until the response headers
+//	http_request_bytes, the size of the request bodies
+//	http_response_bytes, the size of the response bodies read
+//	http_error_count, failed requests and 5xx responses
+//
+// For example, to also propagate the origins:
+//
+//	httpClient := &http.Client{Transport: &client.Transport{
+//		Client: c,
+//		Base:   client.Propagator{}.Transport(nil),
+//	}}
+type Transport struct {
+	Client *Client
+
+	// Base is the round tripper sending the requests.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Target returns the target of a request. If nil,
+	// the host of the request URL is the target.
+	Target func(r *http.Request) string
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	target := r.URL.Host
+	if t.Target != nil {
+		target = t.Target(r)
+	}
+	ctx := r.Context()
+	if r.Body != nil && r.Body != http.NoBody {
+		// Count the bytes sent, the content length is unknown
+		// for chunked bodies. Round trippers must not modify
+		// the request.
+		body := &countingBody{ReadCloser: r.Body, done: func(n int64) {
+			if n > 0 {
+				t.Client.Record(ctx, target, "http_request_bytes", float64(n))
+			}
+		}}
+		r = r.WithContext(ctx)
+		r.Body = body
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(r)
+	latency := float64(time.Since(start)) / float64(time.Millisecond)
+
+	t.Client.Record(ctx, target, "http_request_count", 1)
+	t.Client.Record(ctx, target, "http_request_latency_ms", latency)
+	if err != nil || resp.StatusCode >= 500 {
+		t.Client.Record(ctx, target, "http_error_count", 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: func(n int64) {
+		if n > 0 {
+			t.Client.Record(ctx, target, "http_response_bytes", float64(n))
+		}
+	}}
+	return resp, nil
+}
+
+// countingBody counts the bytes read from the body and
+// calls done once the body is read to the end or closed.
+// Request bodies may be closed while they are read.
+type countingBody struct {
+	io.ReadCloser
+	n    atomic.Int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.n.Load()) })
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.once.Do(func() { b.done(b.n.Load()) })
+	return b.ReadCloser.Close()
+}
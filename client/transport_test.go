@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mykodev/myko/mykotest"
+)
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello, world"))
+	}))
+	defer srv.Close()
+
+	inserter := &mykotest.Service{}
+	c := New(inserter, Options{})
+	httpClient := &http.Client{Transport: &Transport{
+		Client: c,
+		Target: func(*http.Request) string { return "users" },
+	}}
+
+	ctx := WithOrigin(context.Background(), "site_navbar")
+	bodies := map[string]io.Reader{
+		"/":     strings.NewReader("ping"),
+		"/fail": strings.NewReader("ping"),
+		// The length of chunked bodies is unknown.
+		"/chunked": io.MultiReader(strings.NewReader("chunked")),
+	}
+	for _, path := range []string{"/", "/fail", "/chunked"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+path, bodies[path])
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do() = %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]float64)
+	for _, e := range inserter.Entries() {
+		if e.Target != "users" || e.Origin != "site_navbar" {
+			t.Errorf("entry = %v/%v, want users/site_navbar", e.Target, e.Origin)
+		}
+		for _, ev := range e.Events {
+			got[ev.Name] = ev.Value
+		}
+	}
+	want := map[string]float64{
+		"http_request_count":  3,
+		"http_request_bytes":  15,
+		"http_response_bytes": 24,
+		"http_error_count":    1,
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s = %v, want %v", name, got[name], v)
+		}
+	}
+}
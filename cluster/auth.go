@@ -0,0 +1,44 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+// secretHeader carries the cluster secret
+// of the requests forwarded by members.
+const secretHeader = "Myko-Cluster-Secret"
+
+type memberKey struct{}
+
+// Authenticate marks the requests carrying the cluster secret
+// as sent by a member, see IsMember.
+func Authenticate(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(secretHeader)
+		if secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1 {
+			r = r.WithContext(context.WithValue(r.Context(), memberKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsMember reports whether the request of ctx is sent by
+// a member of the cluster and authenticated by Authenticate.
+func IsMember(ctx context.Context) bool {
+	member, _ := ctx.Value(memberKey{}).(bool)
+	return member
+}
+
+// secretTransport adds the cluster secret to the requests.
+type secretTransport struct {
+	secret string
+	next   http.RoundTripper
+}
+
+func (t *secretTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(secretHeader, t.secret)
+	return t.next.RoundTrip(r)
+}
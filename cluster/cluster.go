@@ -0,0 +1,181 @@
+// Package cluster assigns the aggregation keys to the members
+// of a cluster of servers and keeps track of the membership.
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mykodev/myko/config"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Cluster is the membership of a cluster as seen by a member.
+type Cluster struct {
+	cfg config.ClusterConfig
+
+	mu      sync.RWMutex // guards ring and clients
+	ring    *Ring
+	clients map[string]pb.Service
+}
+
+// New returns the cluster with the members in the config.
+func New(cfg config.ClusterConfig) (*Cluster, error) {
+	if cfg.Self == "" {
+		return nil, errors.New("cluster member address is not configured")
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("cluster secret is not configured")
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 10 * time.Second
+	}
+	if cfg.VirtualNodes <= 0 {
+		cfg.VirtualNodes = 128
+	}
+	c := &Cluster{cfg: cfg, clients: make(map[string]pb.Service)}
+	members, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.ring = NewRing(members, cfg.VirtualNodes)
+	return c, nil
+}
+
+// Self returns the address of this member.
+func (c *Cluster) Self() string {
+	return c.cfg.Self
+}
+
+// Owner returns the address of the member owning key.
+func (c *Cluster) Owner(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.Owner(key)
+}
+
+// Client returns the client of the member at addr. Its
+// requests carry the cluster secret.
+func (c *Cluster) Client(addr string) pb.Service {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[addr]
+	if !ok {
+		client = pb.NewServiceProtobufClient(addr, &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &secretTransport{secret: c.cfg.Secret, next: http.DefaultTransport},
+		})
+		c.clients[addr] = client
+	}
+	return client
+}
+
+// Watch reloads the members file every refresh interval until
+// ctx is done. If the members change, onChange is called after
+// the new members take effect. It's a no-op for static members.
+func (c *Cluster) Watch(ctx context.Context, onChange func()) {
+	if c.cfg.MembersFile == "" {
+		return
+	}
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			members, err := c.load()
+			if err != nil {
+				log.Printf("Failed to load the cluster members: %v", err)
+				continue
+			}
+			if !c.update(members) {
+				continue
+			}
+			log.Printf("Cluster members changed to %v", members)
+			onChange()
+		}
+	}
+}
+
+// update replaces the ring if members differ from the
+// current ones and reports whether it did.
+func (c *Cluster) update(members []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if equal(members, c.ring.Members()) {
+		return false
+	}
+	c.ring = NewRing(members, c.cfg.VirtualNodes)
+	for addr := range c.clients {
+		if !contains(members, addr) {
+			delete(c.clients, addr)
+		}
+	}
+	return true
+}
+
+// load returns the sorted members from the members file
+// if set, or from the config.
+func (c *Cluster) load() ([]string, error) {
+	members := c.cfg.Members
+	if c.cfg.MembersFile != "" {
+		b, err := os.ReadFile(c.cfg.MembersFile)
+		if err != nil {
+			return nil, err
+		}
+		members = parseMembers(b)
+	}
+	if len(members) == 0 {
+		return nil, errors.New("cluster has no members")
+	}
+	members = append([]string(nil), members...)
+	sort.Strings(members)
+	return members, nil
+}
+
+// parseMembers parses a members file listing an address per
+// line. Empty lines and lines starting with # are skipped.
+func parseMembers(b []byte) []string {
+	var members []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		members = append(members, line)
+	}
+	return members
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(members []string, addr string) bool {
+	for _, m := range members {
+		if m == addr {
+			return true
+		}
+	}
+	return false
+}
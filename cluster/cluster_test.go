@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/mykodev/myko/config"
+)
+
+func TestRing(t *testing.T) {
+	members := []string{"http://myko-0:6959", "http://myko-1:6959", "http://myko-2:6959"}
+	ring := NewRing(members, 128)
+	grown := NewRing(append(members, "http://myko-3:6959"), 128)
+
+	owned := make(map[string]int)
+	var moved int
+	for i := 0; i < 10000; i++ {
+		key := "mysql:origin_" + strconv.Itoa(i)
+		owner := ring.Owner(key)
+		owned[owner]++
+		if newOwner := grown.Owner(key); newOwner != owner {
+			moved++
+			if newOwner != "http://myko-3:6959" {
+				t.Fatalf("key %q moved from %q to %q, want to the new member", key, owner, newOwner)
+			}
+		}
+	}
+	for _, m := range members {
+		if owned[m] < 2000 {
+			t.Errorf("%q owns %d of 10000 keys, want about 3333", m, owned[m])
+		}
+	}
+	if moved < 1500 || moved > 3500 {
+		t.Errorf("%d of 10000 keys moved to the new member, want about 2500", moved)
+	}
+}
+
+func TestCluster_MembersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "members")
+	if err := os.WriteFile(path, []byte("# myko\nhttp://myko-1:6959\n\nhttp://myko-0:6959\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(config.ClusterConfig{Self: "http://myko-0:6959", MembersFile: path, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	if got := c.ring.Members(); len(got) != 2 || got[0] != "http://myko-0:6959" {
+		t.Errorf("members = %v", got)
+	}
+
+	members, err := c.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.update(members) {
+		t.Errorf("update() = true for the same members")
+	}
+	if !c.update([]string{"http://myko-0:6959"}) {
+		t.Errorf("update() = false for changed members")
+	}
+	if owner := c.Owner("mysql:site_navbar"); owner != "http://myko-0:6959" {
+		t.Errorf("Owner() = %q, want the only member", owner)
+	}
+}
@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/mykodev/myko/internal/hashing"
+)
+
+// Ring is a consistent hash ring of members. Adding or removing
+// a member only moves the keys owned by that member.
+type Ring struct {
+	members []string
+	points  []uint64
+	owners  map[uint64]string
+}
+
+// NewRing returns a ring placing every member at
+// virtualNodes points.
+func NewRing(members []string, virtualNodes int) *Ring {
+	r := &Ring{
+		members: members,
+		owners:  make(map[uint64]string, len(members)*virtualNodes),
+	}
+	for _, m := range members {
+		for i := 0; i < virtualNodes; i++ {
+			p := hashing.String(m + "#" + strconv.Itoa(i))
+			if _, ok := r.owners[p]; ok {
+				continue // keep the first member at a colliding point
+			}
+			r.owners[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Owner returns the member owning key, the member at the first
+// point following the key's hash. It returns an empty string if
+// the ring has no members.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashing.String(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Members returns the members of the ring.
+func (r *Ring) Members() []string {
+	return r.members
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/mykodev/myko/agent"
+	"github.com/mykodev/myko/config"
+	pb "github.com/mykodev/myko/proto"
+	"github.com/mykodev/myko/server"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// runAgent serves the InsertEvents API locally over TCP and/or
+// a Unix socket, aggregates the entries and forwards the windows
+// upstream, e.g. myko agent -config agent.yaml.
+func runAgent(args []string) {
+	var configFile string
+
+	fs := flag.NewFlagSet("myko agent", flag.ExitOnError)
+	fs.StringVar(&configFile, "config", "", "")
+	fs.Parse(args)
+
+	cfg := config.DefaultAgentConfig()
+	if configFile != "" {
+		var err error
+		cfg, err = config.OpenAgent(configFile)
+		if err != nil {
+			log.Fatalf("Failed to open and parse config file: %v", err)
+		}
+	}
+	if cfg.Upstream == "" {
+		log.Fatal("Upstream server is not configured")
+	}
+	if cfg.Listen == "" && cfg.Socket == "" {
+		log.Fatal("Neither a listen address nor a socket is configured")
+	}
+
+	spool, err := agent.OpenSpool(cfg.SpoolConfig.Dir, cfg.SpoolConfig.MaxSize)
+	if err != nil {
+		log.Fatalf("Failed to open the spool: %v", err)
+	}
+	upstream := pb.NewServiceProtobufClient(cfg.Upstream, &http.Client{})
+	forwarder := agent.NewForwarder(upstream, spool)
+
+	service, err := server.NewWithDatastore(config.Config{
+		FlushConfig:       cfg.FlushConfig,
+		AggregationConfig: cfg.AggregationConfig,
+		StateConfig:       cfg.StateConfig,
+	}, forwarder)
+	if err != nil {
+		log.Fatalf("Failed to create a server: %v", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	pb.RegisterServiceServer(grpcServer, service)
+	pb.RegisterStreamServiceServer(grpcServer, service)
+
+	twirpHandler := pb.NewServiceServer(service, nil)
+	mux := http.NewServeMux()
+	mux.Handle(twirpHandler.PathPrefix(), twirpHandler)
+	httpServer := &http.Server{
+		Handler: h2c.NewHandler(grpcHandler(grpcServer, mux), &http2.Server{}),
+	}
+
+	var listeners []net.Listener
+	if cfg.Listen != "" {
+		lis, err := net.Listen("tcp", cfg.Listen)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		listeners = append(listeners, lis)
+	}
+	if cfg.Socket != "" {
+		// Remove the socket left behind by an unclean exit.
+		if err := os.Remove(cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("Failed to remove the stale socket: %v", err)
+		}
+		lis, err := net.Listen("unix", cfg.Socket)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		listeners = append(listeners, lis)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		forwarder.Run(ctx, cfg.SpoolConfig.RetryInterval)
+	}()
+	go func() {
+		defer wg.Done()
+		service.Run(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+		grpcServer.GracefulStop()
+	}()
+
+	for _, lis := range listeners {
+		lis := lis
+		log.Printf("Starting the myko agent at %q, forwarding to %q...", lis.Addr(), cfg.Upstream)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := httpServer.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Forward or spool the open windows before exiting.
+	if err := service.Close(); err != nil {
+		log.Fatalf("Failed to close the agent: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/importer"
+)
+
+// importFiles backfills entries from CSV or NDJSON files straight
+// to the datastore of the server config, e.g.
+//
+//	myko import -config myko.yaml -mapping import.yaml export.csv
+//
+// Interrupted imports write the rows read so far and resume
+// from where they have stopped when run again.
+func importFiles(args []string) {
+	var configFile, mappingFile string
+
+	fs := flag.NewFlagSet("myko import", flag.ExitOnError)
+	fs.StringVar(&configFile, "config", "", "")
+	fs.StringVar(&mappingFile, "mapping", "", "")
+	fs.Parse(args)
+
+	cfg, err := config.Open(configFile)
+	if err != nil {
+		log.Fatalf("Failed to open and parse config file: %v", err)
+	}
+	importConfig, err := config.OpenImport(mappingFile)
+	if err != nil {
+		log.Fatalf("Failed to open and parse mapping file: %v", err)
+	}
+
+	writer, err := importer.NewWriter(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create a writer: %v", err)
+	}
+	imp, err := importer.New(importConfig, writer)
+	if err != nil {
+		log.Fatalf("Failed to create an importer: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, name := range fs.Args() {
+		if err := imp.Import(ctx, name); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Interrupted, writing the rows read so far...")
+				break
+			}
+			// Exit without writing, the rows since the last
+			// checkpoint are imported again on the next run.
+			log.Fatalf("Failed to import %q: %v", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to write to the datastore: %v", err)
+	}
+}
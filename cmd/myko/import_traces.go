@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/importer"
+	pb "github.com/mykodev/myko/proto"
+	"github.com/mykodev/myko/receiver"
+	"github.com/mykodev/myko/traces"
+)
+
+// importTraces attributes the downstream calls in Jaeger or
+// Zipkin JSON exports to the origins of their traces, e.g.
+//
+//	myko import-traces -format jaeger -server http://localhost:6959 traces.json
+//	myko import-traces -format zipkin -config myko.yaml traces.json
+//
+// With -server, the entries are sent to a running server, which
+// rejects entries older than its tolerance unless -now is set.
+// With -config, the entries are written straight to the datastore
+// of the server config and attributed as its OTLP receiver does.
+func importTraces(args []string) {
+	var (
+		formatName    string
+		serverAddr    string
+		configFile    string
+		interval      time.Duration
+		now           bool
+		originService bool
+		serviceTarget bool
+	)
+
+	fs := flag.NewFlagSet("myko import-traces", flag.ExitOnError)
+	fs.StringVar(&formatName, "format", "jaeger", "jaeger or zipkin")
+	fs.StringVar(&serverAddr, "server", "", "")
+	fs.StringVar(&configFile, "config", "", "")
+	fs.DurationVar(&interval, "interval", time.Minute, "")
+	fs.BoolVar(&now, "now", false, "attribute the calls to the current time")
+	fs.BoolVar(&originService, "origin-service", false, "")
+	fs.BoolVar(&serviceTarget, "service-target", false, "")
+	fs.Parse(args)
+
+	var read func(io.Reader) ([]*traces.Span, error)
+	switch formatName {
+	case "jaeger":
+		read = traces.ReadJaeger
+	case "zipkin":
+		read = traces.ReadZipkin
+	default:
+		log.Fatalf("Unknown trace format %q", formatName)
+	}
+
+	tracesConfig := config.OTLPTracesConfig{
+		OriginService: originService,
+		ServiceTarget: serviceTarget,
+	}
+	var (
+		inserter receiver.Inserter
+		writer   *importer.Writer
+	)
+	switch {
+	case configFile != "":
+		cfg, err := config.Open(configFile)
+		if err != nil {
+			log.Fatalf("Failed to open and parse config file: %v", err)
+		}
+		if otlpConfig := cfg.ReceiversConfig.OTLP; otlpConfig != nil {
+			tracesConfig = otlpConfig.Traces
+		}
+		interval = cfg.FlushConfig.Interval
+		writer, err = importer.NewWriter(cfg)
+		if err != nil {
+			log.Fatalf("Failed to create a writer: %v", err)
+		}
+		inserter = writer
+	case serverAddr != "":
+		inserter = pb.NewServiceProtobufClient(serverAddr, &http.Client{})
+	default:
+		log.Fatal("Either -server or -config is required")
+	}
+
+	attributor := traces.NewAttributor(tracesConfig, interval)
+	err := insertTraces(context.Background(), inserter, attributor, read, fs.Args(), now)
+	// Write the calls attributed so far even if a file has failed.
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			log.Fatalf("Failed to write to the datastore: %v", err)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func insertTraces(ctx context.Context, inserter receiver.Inserter, attributor *traces.Attributor, read func(io.Reader) ([]*traces.Span, error), names []string, now bool) error {
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		spans, err := read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", name, err)
+		}
+		entries, err := attributor.Entries(spans)
+		if err != nil {
+			return fmt.Errorf("failed to attribute %q: %w", name, err)
+		}
+		if now {
+			for _, e := range entries {
+				e.Timestamp = nil
+			}
+		}
+		const batchSize = 1000
+		for len(entries) > 0 {
+			n := len(entries)
+			if n > batchSize {
+				n = batchSize
+			}
+			if _, err := inserter.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries[:n]}); err != nil {
+				return fmt.Errorf("failed to insert the calls of %q: %w", name, err)
+			}
+			entries = entries[n:]
+		}
+		log.Printf("Imported %d spans from %q", len(spans), name)
+	}
+	return nil
+}
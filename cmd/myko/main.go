@@ -1,20 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 
+	"github.com/mykodev/myko/cluster"
 	"github.com/mykodev/myko/config"
 	pb "github.com/mykodev/myko/proto"
+	"github.com/mykodev/myko/receiver/cloudevents"
+	"github.com/mykodev/myko/receiver/otlp"
+	"github.com/mykodev/myko/receiver/prometheus"
+	"github.com/mykodev/myko/receiver/statsd"
 	"github.com/mykodev/myko/server"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 )
 
-var configFile string
-
 func main() {
-	flag.StringVar(&configFile, "config", "", "")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "agent":
+			runAgent(os.Args[2:])
+			return
+		case "tail":
+			tail(os.Args[2:])
+			return
+		case "import":
+			importFiles(os.Args[2:])
+			return
+		case "import-traces":
+			importTraces(os.Args[2:])
+			return
+		}
+	}
+	serve(os.Args[1:])
+}
+
+func serve(args []string) {
+	var configFile string
+
+	fs := flag.NewFlagSet("myko", flag.ExitOnError)
+	fs.StringVar(&configFile, "config", "", "")
+	fs.Parse(args)
 
 	var cfg config.Config
 	if configFile == "" {
@@ -32,7 +69,101 @@ func main() {
 		log.Fatalf("Failed to create a server: %v", err)
 	}
 
+	grpcServer := grpc.NewServer()
+	pb.RegisterServiceServer(grpcServer, service)
+	pb.RegisterStreamServiceServer(grpcServer, service)
+
+	twirpHandler := pb.NewServiceServer(service, nil)
+	mux := http.NewServeMux()
+	if clusterConfig := cfg.ClusterConfig; clusterConfig != nil {
+		// Members forward entries with the cluster secret.
+		mux.Handle(twirpHandler.PathPrefix(), cluster.Authenticate(clusterConfig.Secret, twirpHandler))
+	} else {
+		mux.Handle(twirpHandler.PathPrefix(), twirpHandler)
+	}
+	if otlpConfig := cfg.ReceiversConfig.OTLP; otlpConfig != nil {
+		receiver := otlp.New(*otlpConfig, service)
+		mux.Handle("/v1/", receiver.Handler())
+		receiver.RegisterGRPC(grpcServer)
+	}
+	if promConfig := cfg.ReceiversConfig.Prometheus; promConfig != nil {
+		receiver := prometheus.New(*promConfig, service)
+		mux.Handle(receiver.Path(), receiver)
+	}
+	if ceConfig := cfg.ReceiversConfig.CloudEvents; ceConfig != nil {
+		receiver, err := cloudevents.New(*ceConfig, service)
+		if err != nil {
+			log.Fatalf("Failed to create the CloudEvents receiver: %v", err)
+		}
+		mux.Handle(receiver.Path(), receiver)
+	}
+
+	var handler http.Handler = mux
+	if cfg.GRPCListen == "" {
+		// Serve gRPC on the same port, gRPC requests
+		// are HTTP/2 requests with a gRPC content type.
+		handler = h2c.NewHandler(grpcHandler(grpcServer, handler), &http2.Server{})
+	} else {
+		lis, err := net.Listen("tcp", cfg.GRPCListen)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC: %v", err)
+		}
+		log.Printf("Starting the myko gRPC server at %q...", cfg.GRPCListen)
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Flush the closed windows and watch the cluster members.
+		service.Run(ctx)
+	}()
+	if statsdConfig := cfg.ReceiversConfig.StatsD; statsdConfig != nil {
+		receiver := statsd.New(*statsdConfig, service)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := receiver.Serve(ctx); err != nil {
+				log.Fatalf("Failed to serve the StatsD receiver: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Starting the myko server at %q...", cfg.Listen)
-	server := pb.NewServiceServer(service, nil)
-	log.Fatal(http.ListenAndServe(cfg.Listen, server))
+	httpServer := &http.Server{
+		Addr:    cfg.Listen,
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+		grpcServer.GracefulStop()
+	}()
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	wg.Wait()
+
+	// Flush in-memory data points before exiting.
+	if err := service.Close(); err != nil {
+		log.Fatalf("Failed to close the server: %v", err)
+	}
+}
+
+func grpcHandler(grpcServer *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
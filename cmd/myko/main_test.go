@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/mykotest"
+	"github.com/mykodev/myko/server"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// dialGRPC serves the service over h2c as serve does
+// and returns a gRPC connection to it.
+func dialGRPC(t *testing.T) *grpc.ClientConn {
+	service, err := server.NewWithDatastore(config.DefaultConfig(), &mykotest.Datastore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterServiceServer(grpcServer, service)
+	pb.RegisterStreamServiceServer(grpcServer, service)
+
+	lis := bufconn.Listen(1 << 20)
+	httpServer := &http.Server{Handler: h2c.NewHandler(grpcHandler(grpcServer, http.NotFoundHandler()), &http2.Server{})}
+	go httpServer.Serve(lis)
+	t.Cleanup(func() { httpServer.Close() })
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+var (
+	validEntry   = &pb.Entry{Target: "mysql", Origin: "site_navbar", Events: []*pb.Event{{Name: "query_count", Value: 1}}}
+	invalidEntry = &pb.Entry{Target: "mysql", Events: []*pb.Event{{Name: "query_count", Value: 1}}}
+)
+
+func TestGRPC_InsertEvents(t *testing.T) {
+	client := pb.NewServiceClient(dialGRPC(t))
+	ctx := context.Background()
+
+	resp, err := client.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: []*pb.Entry{validEntry}})
+	if err != nil {
+		t.Fatalf("InsertEvents() = %v", err)
+	}
+	if resp.Accepted != 1 {
+		t.Errorf("accepted = %v, want 1", resp.Accepted)
+	}
+	_, err = client.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: []*pb.Entry{validEntry, invalidEntry}})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("InsertEvents() = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestGRPC_InsertEventsStream(t *testing.T) {
+	client := pb.NewStreamServiceClient(dialGRPC(t))
+	ctx := context.Background()
+
+	tests := []struct {
+		reqs         []*pb.InsertEventsRequest
+		wantAccepted uint32
+		wantIndexes  []uint32
+		wantCode     codes.Code
+	}{
+		{
+			reqs: []*pb.InsertEventsRequest{
+				{Entries: []*pb.Entry{validEntry, invalidEntry}, Partial: true},
+				{Entries: []*pb.Entry{invalidEntry, validEntry}, Partial: true},
+			},
+			wantAccepted: 2,
+			wantIndexes:  []uint32{1, 2},
+		},
+		{
+			reqs: []*pb.InsertEventsRequest{
+				{Entries: []*pb.Entry{validEntry}},
+				{Entries: []*pb.Entry{invalidEntry}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for i, tt := range tests {
+		stream, err := client.InsertEventsStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, req := range tt.reqs {
+			if err := stream.Send(req); err != nil {
+				break // the error is received by CloseAndRecv
+			}
+		}
+		resp, err := stream.CloseAndRecv()
+		if code := status.Code(err); code != tt.wantCode {
+			t.Errorf("#%d: CloseAndRecv() = %v, want code %v", i, err, tt.wantCode)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if resp.Accepted != tt.wantAccepted || len(resp.Rejections) != len(tt.wantIndexes) {
+			t.Errorf("#%d: CloseAndRecv() = %v, want %d accepted and rejections %v", i, resp, tt.wantAccepted, tt.wantIndexes)
+			continue
+		}
+		for j, r := range resp.Rejections {
+			if r.Index != tt.wantIndexes[j] {
+				t.Errorf("#%d: rejection %d index = %d, want %d", i, j, r.Index, tt.wantIndexes[j])
+			}
+		}
+	}
+}
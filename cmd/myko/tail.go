@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mykodev/myko/config"
+	pb "github.com/mykodev/myko/proto"
+	mykotail "github.com/mykodev/myko/tail"
+)
+
+// tail follows log files and sends the parsed events
+// to a myko server, e.g. myko tail -config tail.yaml.
+func tail(args []string) {
+	var configFile string
+
+	fs := flag.NewFlagSet("myko tail", flag.ExitOnError)
+	fs.StringVar(&configFile, "config", "", "")
+	fs.Parse(args)
+
+	cfg, err := config.OpenTail(configFile)
+	if err != nil {
+		log.Fatalf("Failed to open and parse config file: %v", err)
+	}
+
+	client := pb.NewServiceProtobufClient(cfg.Server, &http.Client{})
+	tailer, err := mykotail.New(cfg, client)
+	if err != nil {
+		log.Fatalf("Failed to create a tailer: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Tailing %d files...", len(cfg.Files))
+	if err := tailer.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
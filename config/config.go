@@ -10,9 +10,26 @@ import (
 type Config struct {
 	Listen string `yaml:"listen"`
 
+	// GRPCListen is the address the gRPC server listens at.
+	// If not set, gRPC is served at Listen along with Twirp.
+	GRPCListen string `yaml:"grpc_listen,omitempty"`
+
 	DataConfig DataConfig `yaml:"data"`
 
 	FlushConfig FlushConfig `yaml:"flush"`
+
+	AggregationConfig AggregationConfig `yaml:"aggregation"`
+
+	StateConfig StateConfig `yaml:"state"`
+
+	QueryConfig QueryConfig `yaml:"query"`
+
+	ReceiversConfig ReceiversConfig `yaml:"receivers"`
+
+	// ClusterConfig configures the cluster the server is a
+	// member of. If not set, the server aggregates all entries
+	// it receives.
+	ClusterConfig *ClusterConfig `yaml:"cluster,omitempty"`
 }
 
 func DefaultConfig() Config {
@@ -21,6 +38,11 @@ func DefaultConfig() Config {
 		FlushConfig: FlushConfig{
 			BufferSize: 8 * 1024,
 			Interval:   60 * time.Second,
+			Tolerance:  30 * time.Second,
+		},
+		AggregationConfig: AggregationConfig{
+			CumulativeExpiry:  24 * time.Hour,
+			IdempotencyWindow: time.Hour,
 		},
 	}
 }
@@ -35,6 +57,11 @@ type KustoConfig struct {
 	Database string `yaml:"database,omitempty"`
 
 	Table string `yaml:"table,omitempty"`
+
+	// IngestionMapping is the name of the JSON ingestion mapping
+	// of the table, see datastore/kusto/schema.kql. If not set,
+	// entries are ingested into the columns of the same name.
+	IngestionMapping string `yaml:"ingestion_mapping,omitempty"`
 }
 
 type CassandraConfig struct {
@@ -58,21 +85,446 @@ type FlushConfig struct {
 	// kept in-memory before they are flushed out to the datastore.
 	BufferSize int `yaml:"buffer_size"`
 
-	// Interval is the uppermost duration to wait before
-	// all in-memory data points are flushed out to the datastore.
+	// Interval is the length of the aggregation windows. Windows
+	// are aligned to the wall-clock multiples of the interval.
 	Interval time.Duration `yaml:"interval"`
+
+	// Tolerance is how late or early the timestamp of an entry
+	// can be. Late entries are aggregated into their past windows
+	// which are kept open until their end is older than the
+	// tolerance, so windows are written Interval+Tolerance after
+	// they start. Entries older than the tolerance are rejected.
+	// Raise it for producers that buffer entries for longer.
+	Tolerance time.Duration `yaml:"tolerance"`
 }
 
-func Open(path string) (Config, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return Config{}, err
+type AggregationConfig struct {
+	// Exact maps event names to the number of decimal places
+	// their values are kept with. Values of these events are
+	// summed as fixed-point decimals instead of floating point
+	// numbers, e.g. for billing-grade totals.
+	Exact map[string]int `yaml:"exact,omitempty"`
+
+	// CumulativeExpiry is how long the last value of a cumulative
+	// counter is remembered after it was last reported.
+	CumulativeExpiry time.Duration `yaml:"cumulative_expiry"`
+
+	// IdempotencyWindow is how long the idempotency keys of
+	// inserted requests are remembered. Retries later than the
+	// window are aggregated again.
+	IdempotencyWindow time.Duration `yaml:"idempotency_window"`
+}
+
+type StateConfig struct {
+	// Dir is the directory where the server keeps the state that
+	// needs to survive restarts, such as the last values of cumulative
+	// counters and the idempotency keys of inserted requests. If not
+	// set, the state is kept only in memory.
+	Dir string `yaml:"dir,omitempty"`
+}
+
+// ReceiversConfig configures the receivers that convert
+// other telemetry formats into entries. Receivers that are
+// not set are disabled.
+type ReceiversConfig struct {
+	OTLP *OTLPConfig `yaml:"otlp,omitempty"`
+
+	Prometheus *PrometheusConfig `yaml:"prometheus,omitempty"`
+
+	StatsD *StatsDConfig `yaml:"statsd,omitempty"`
+
+	CloudEvents *CloudEventsConfig `yaml:"cloudevents,omitempty"`
+}
+
+// OTLPConfig configures how OpenTelemetry traces and metrics
+// are converted into entries. OTLP/HTTP is served at /v1/traces
+// and /v1/metrics, OTLP/gRPC is served along with the gRPC service.
+type OTLPConfig struct {
+	Traces OTLPTracesConfig `yaml:"traces"`
+
+	Metrics []OTLPMetricConfig `yaml:"metrics,omitempty"`
+}
+
+// OTLPTracesConfig configures how client spans are attributed
+// to the origin of their root span.
+type OTLPTracesConfig struct {
+	// OriginAttributes are the root span attributes used as the
+	// origin. The first attribute that is set is used. If none is
+	// set, the root span name is used. Defaults to http.route and
+	// rpc.method. Spans whose root span is not exported together
+	// with them are attributed to the "unknown" origin.
+	OriginAttributes []string `yaml:"origin_attributes,omitempty"`
+
+	// OriginService prefixes origins with the service name of
+	// the root span, e.g. "webserver/site_navbar".
+	OriginService bool `yaml:"origin_service,omitempty"`
+
+	// TargetAttributes are the client span attributes used as the
+	// target. The first attribute that is set is used. Client spans
+	// with none of them are ignored. Defaults to peer.service,
+	// db.system and net.peer.name.
+	TargetAttributes []string `yaml:"target_attributes,omitempty"`
+
+	// ServiceTarget also attributes root spans to the service
+	// that has served them as the target.
+	ServiceTarget bool `yaml:"service_target,omitempty"`
+
+	// CountEvent is the event name of the span counts.
+	// Defaults to span_count.
+	CountEvent string `yaml:"count_event,omitempty"`
+
+	// DurationEvent is the event name of the span durations
+	// in milliseconds. Defaults to span_duration_ms.
+	DurationEvent string `yaml:"duration_event,omitempty"`
+}
+
+// OTLPMetricConfig maps the data points of a metric to entries.
+// Monotonic sums and histograms are supported, cumulative data
+// points are converted into deltas.
+type OTLPMetricConfig struct {
+	// Metric is the OpenTelemetry metric name.
+	Metric string `yaml:"metric"`
+
+	// Event is the event name. Defaults to the metric name
+	// with dots replaced by underscores. Histograms are reported
+	// as two events, the sum as event and the count as event_count.
+	Event string `yaml:"event,omitempty"`
+
+	// OriginAttribute is the data point attribute used as the
+	// origin. Data points without it are ignored.
+	OriginAttribute string `yaml:"origin_attribute"`
+
+	// TargetAttribute is the data point attribute used as the
+	// target. If not set, the service name is the target.
+	TargetAttribute string `yaml:"target_attribute,omitempty"`
+}
+
+// PrometheusConfig configures the Prometheus remote-write
+// receiver. Samples of the configured metrics are converted
+// into entries, other samples are ignored.
+type PrometheusConfig struct {
+	// Path is the HTTP path of the remote-write endpoint.
+	// Defaults to /api/v1/write.
+	Path string `yaml:"path,omitempty"`
+
+	Metrics []PrometheusMetricConfig `yaml:"metrics,omitempty"`
+}
+
+// PrometheusMetricConfig maps the samples of a metric to entries.
+type PrometheusMetricConfig struct {
+	// Metric is the Prometheus metric name.
+	Metric string `yaml:"metric"`
+
+	// Event is the event name. Defaults to the metric name.
+	Event string `yaml:"event,omitempty"`
+
+	// OriginLabel is the label used as the origin.
+	// Samples without it are ignored.
+	OriginLabel string `yaml:"origin_label"`
+
+	// TargetLabel is the label used as the target.
+	// Samples without it are ignored.
+	TargetLabel string `yaml:"target_label"`
+
+	// Gauge reports the sample values as they are. By default,
+	// metrics are counters and samples are converted into deltas.
+	Gauge bool `yaml:"gauge,omitempty"`
+}
+
+// StatsDConfig configures the receiver of text lines sent
+// over datagrams, in the following format:
+//
+//	<target>;<origin>;<event>:<value>[|<unit>][|@<sample_rate>]
+type StatsDConfig struct {
+	// Listen is the UDP address to listen at, e.g. ":8125".
+	Listen string `yaml:"listen,omitempty"`
+
+	// Socket is the path of the Unix datagram socket to listen at.
+	Socket string `yaml:"socket,omitempty"`
+
+	// FlushInterval is the uppermost duration to wait before the
+	// received lines are inserted. Defaults to a second.
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty"`
+}
+
+// CloudEventsConfig configures the receiver of CloudEvents
+// sent over HTTP in binary or structured mode. Events of the
+// mapped types are converted into entries, other events are
+// ignored.
+type CloudEventsConfig struct {
+	// Path is the HTTP path of the endpoint.
+	// Defaults to /cloudevents.
+	Path string `yaml:"path,omitempty"`
+
+	Mappings []CloudEventMappingConfig `yaml:"mappings,omitempty"`
+}
+
+// CloudEventMappingConfig maps the events of a type to entries.
+// Fields are the context attributes such as source and subject,
+// and the fields of JSON data prefixed with "data.", e.g.
+// data.route or data.user.id for nested objects. The origin
+// field defaults to source and the time field to time.
+type CloudEventMappingConfig struct {
+	// Type is the CloudEvents type, e.g. com.example.order.created.
+	Type string `yaml:"type"`
+
+	EntryMappingConfig `yaml:",inline"`
+}
+
+// QueryConfig configures the Query API.
+type QueryConfig struct {
+	// Unflushed makes queries also read the windows that are not
+	// flushed to the datastore yet, so entries are visible as soon
+	// as they are inserted. Queries overlapping a flush are
+	// retried. In a cluster, only the windows of the queried
+	// member are read.
+	Unflushed bool `yaml:"unflushed,omitempty"`
+}
+
+// ClusterConfig configures a cluster of servers sharing the
+// ingestion. Every aggregation key is owned by a member, picked
+// by consistent hashing, and entries received by other members
+// are forwarded to the owner, so a key has one sum per window.
+type ClusterConfig struct {
+	// Self is the address of this member as listed
+	// in the members, e.g. http://myko-0:6959.
+	Self string `yaml:"self"`
+
+	// Members are the addresses of all members.
+	Members []string `yaml:"members,omitempty"`
+
+	// MembersFile is a file listing the addresses of all
+	// members, one per line. It's reloaded every refresh
+	// interval and takes precedence over Members.
+	MembersFile string `yaml:"members_file,omitempty"`
+
+	// RefreshInterval is how often the members file is
+	// reloaded. Defaults to 10 seconds.
+	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"`
+
+	// VirtualNodes is the number of points each member has
+	// on the hash ring. Defaults to 128.
+	VirtualNodes int `yaml:"virtual_nodes,omitempty"`
+
+	// Secret authenticates the entries forwarded between the
+	// members. All members need the same secret, and forwarded
+	// entries without it are rejected.
+	Secret string `yaml:"secret"`
+}
+
+// AgentConfig configures the agent command that serves the
+// InsertEvents API locally, aggregates the entries and forwards
+// the aggregated windows to an upstream myko server.
+type AgentConfig struct {
+	// Listen is the TCP address to listen at.
+	Listen string `yaml:"listen,omitempty"`
+
+	// Socket is the path of the Unix socket to listen at.
+	Socket string `yaml:"socket,omitempty"`
+
+	// Upstream is the address of the upstream myko server,
+	// e.g. http://myko:6959.
+	Upstream string `yaml:"upstream"`
+
+	// FlushConfig configures the windows of the agent. Their
+	// interval needs to divide the interval of the upstream
+	// windows, so forwarded windows don't span two upstream ones.
+	// Upstream accepts the forwarded windows however late they
+	// are, so the tolerance only needs to cover the local clients.
+	FlushConfig FlushConfig `yaml:"flush"`
+
+	AggregationConfig AggregationConfig `yaml:"aggregation"`
+
+	StateConfig StateConfig `yaml:"state"`
+
+	SpoolConfig SpoolConfig `yaml:"spool"`
+}
+
+// SpoolConfig configures where the agent keeps the windows
+// until they are forwarded, e.g. while upstream is unreachable.
+// Entries rejected by upstream are kept in the directory as
+// files with the .rejected extension.
+type SpoolConfig struct {
+	// Dir is the spool directory. If not set, windows are kept
+	// in memory and lost if the agent exits before they are
+	// forwarded.
+	Dir string `yaml:"dir,omitempty"`
+
+	// MaxSize is the uppermost size of the spool in bytes. New
+	// windows are kept by the agent's server once the spool is
+	// full. Defaults to 1 GiB.
+	MaxSize int64 `yaml:"max_size,omitempty"`
+
+	// RetryInterval is how often forwarding the spooled windows
+	// is retried. Defaults to 10 seconds.
+	RetryInterval time.Duration `yaml:"retry_interval,omitempty"`
+}
+
+func DefaultAgentConfig() AgentConfig {
+	cfg := DefaultConfig()
+	return AgentConfig{
+		Listen: "localhost:6960",
+		FlushConfig: FlushConfig{
+			BufferSize: cfg.FlushConfig.BufferSize,
+			Interval:   10 * time.Second,
+			Tolerance:  15 * time.Second,
+		},
+		AggregationConfig: cfg.AggregationConfig,
+		SpoolConfig: SpoolConfig{
+			MaxSize:       1 << 30,
+			RetryInterval: 10 * time.Second,
+		},
 	}
-	defer f.Close()
+}
+
+// TailConfig configures the tail command that follows
+// log files and sends the parsed events to a myko server.
+type TailConfig struct {
+	// Server is the address of the myko server.
+	Server string `yaml:"server"`
+
+	// Checkpoint is the path of the file where the read offsets
+	// of the log files are saved, so restarts don't read the
+	// same lines again. If empty, the offsets are not saved.
+	Checkpoint string `yaml:"checkpoint"`
+
+	// PollInterval is how often the log files are checked for
+	// new lines. Defaults to a second.
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+
+	Files []TailFileConfig `yaml:"files"`
+}
+
+// TailFileConfig configures how the lines of a log file are
+// parsed into fields and how fields are mapped to an entry.
+type TailFileConfig struct {
+	Path string `yaml:"path"`
+
+	// FromStart reads files without a checkpoint from the
+	// beginning. By default, they are read from their end,
+	// so the lines written before tail has started are not
+	// attributed to the current time.
+	FromStart bool `yaml:"from_start,omitempty"`
+
+	// Format is the format of the lines, one of regex, json,
+	// logfmt or mysql_slow. The mysql_slow format parses MySQL
+	// slow query logs. By default, its target is the database and
+	// its events are sql_query_count, sql_query_latency_ms and
+	// sql_rows_examined.
+	Format string `yaml:"format"`
+
+	// Pattern is the regular expression of the regex format.
+	// Its named groups are the fields.
+	Pattern string `yaml:"pattern,omitempty"`
+
+	// SQLCommenterField is the field of SQL queries tagged with
+	// sqlcommenter comments. The attributes in the comments become
+	// fields, e.g. the route attribute can be used as the origin
+	// field. Defaults to query for the mysql_slow format.
+	SQLCommenterField string `yaml:"sqlcommenter_field,omitempty"`
+
+	EntryMappingConfig `yaml:",inline"`
+}
+
+// EntryMappingConfig maps the fields of a record, such as a
+// parsed log line, an event or an imported row, to an entry.
+type EntryMappingConfig struct {
+	// Target is the target of all the entries. If not set,
+	// TargetField is used.
+	Target string `yaml:"target,omitempty"`
+
+	TargetField string `yaml:"target_field,omitempty"`
+
+	OriginField string `yaml:"origin_field"`
 
+	// TimeField is the field of the time the events have happened.
+	// Records without it are attributed to the time they are
+	// received.
+	TimeField string `yaml:"time_field,omitempty"`
+
+	// TimeLayout is the layout of the time field as accepted by
+	// time.Parse, or unix and unix_ms for seconds and milliseconds
+	// since epoch. Defaults to RFC 3339.
+	TimeLayout string `yaml:"time_layout,omitempty"`
+
+	Events []EventMappingConfig `yaml:"events"`
+}
+
+// EventMappingConfig maps a field to the value of an event.
+type EventMappingConfig struct {
+	Name string `yaml:"name"`
+
+	// Field is the field of the event value. If not set,
+	// the value is 1, e.g. to count requests.
+	Field string `yaml:"field,omitempty"`
+
+	// Unit is appended to the event name, e.g. ms makes
+	// the request_duration event request_duration_ms.
+	Unit string `yaml:"unit,omitempty"`
+
+	// Scale multiplies the value, e.g. 1000 to report
+	// seconds as milliseconds. Defaults to 1. The import
+	// command imports the values of exact events that are
+	// not scaled as decimals without rounding errors.
+	Scale float64 `yaml:"scale,omitempty"`
+}
+
+// ImportConfig configures the import command that backfills
+// entries from CSV or NDJSON files straight to the datastore.
+type ImportConfig struct {
+	// Format is the format of the files, csv or ndjson. The
+	// first row of CSV files is the header with the column names.
+	Format string `yaml:"format"`
+
+	// Checkpoint is the path of the file where the progress of the
+	// imports is saved, so interrupted imports resume where they
+	// have stopped.
+	Checkpoint string `yaml:"checkpoint,omitempty"`
+
+	// EntryMappingConfig maps the columns of the rows, or the
+	// keys of the NDJSON objects, to entries. The time field is
+	// required.
+	EntryMappingConfig `yaml:",inline"`
+}
+
+func Open(path string) (Config, error) {
 	config := DefaultConfig()
-	if err := yaml.NewDecoder(f).Decode(&config); err != nil {
+	if err := decode(path, &config); err != nil {
 		return Config{}, err
 	}
 	return config, nil
 }
+
+func OpenTail(path string) (TailConfig, error) {
+	config := TailConfig{PollInterval: time.Second}
+	if err := decode(path, &config); err != nil {
+		return TailConfig{}, err
+	}
+	return config, nil
+}
+
+func OpenAgent(path string) (AgentConfig, error) {
+	config := DefaultAgentConfig()
+	if err := decode(path, &config); err != nil {
+		return AgentConfig{}, err
+	}
+	return config, nil
+}
+
+func OpenImport(path string) (ImportConfig, error) {
+	var config ImportConfig
+	if err := decode(path, &config); err != nil {
+		return ImportConfig{}, err
+	}
+	return config, nil
+}
+
+func decode(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return yaml.NewDecoder(f).Decode(v)
+}
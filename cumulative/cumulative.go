@@ -0,0 +1,125 @@
+// Package cumulative converts the values of monotonically
+// increasing counters into deltas between reports.
+package cumulative
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mykodev/myko/atomicfile"
+)
+
+// Tracker remembers the last reported value of counters
+// and converts new reports into deltas. If opened with a
+// path, the committed reports are saved to the path and
+// survive restarts.
+type Tracker struct {
+	path   string
+	expiry time.Duration
+
+	mu       sync.Mutex // guards counters and saved
+	counters map[string]Report
+	saved    map[string]Report // committed reports
+}
+
+// Report is a reported value of a counter.
+type Report struct {
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Open opens a tracker and loads the counters saved at path.
+// If path is empty, counters are kept only in memory. Counters
+// that are not reported for longer than expiry are forgotten
+// when the tracker is saved.
+func Open(path string, expiry time.Duration) (*Tracker, error) {
+	t := &Tracker{
+		path:     path,
+		expiry:   expiry,
+		counters: make(map[string]Report),
+		saved:    make(map[string]Report),
+	}
+	if path == "" {
+		return t, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&t.saved); err != nil {
+		return nil, err
+	}
+	for key, r := range t.saved {
+		t.counters[key] = r
+	}
+	return t, nil
+}
+
+// Delta returns the increase of the counter identified by key
+// since its last report. The first report of a counter only
+// records the value and the delta is 0. If the value is smaller
+// than the last report, the counter is considered to be reset
+// and the value itself is the delta. Reports that are not later
+// than the last report are out of order, they are ignored and
+// ok is false.
+func (t *Tracker) Delta(key string, r Report) (delta float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, seen := t.counters[key]
+	if seen && !r.Time.After(last.Time) {
+		return 0, false
+	}
+	t.counters[key] = r
+	if !seen {
+		return 0, true
+	}
+	delta = r.Value - last.Value
+	if delta < 0 {
+		delta = r.Value
+	}
+	return delta, true
+}
+
+// Commit marks the reports as the last ones whose deltas are
+// written, so they are saved. Until then, the last committed
+// reports are saved, and the deltas are computed from them
+// again after a restart rather than being lost.
+func (t *Tracker) Commit(reports map[string]Report) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, r := range reports {
+		if last, ok := t.saved[key]; !ok || r.Time.After(last.Time) {
+			t.saved[key] = r
+		}
+	}
+}
+
+// Save forgets the expired counters and writes the committed
+// reports to the tracker's path. It is a no-op for in-memory
+// trackers.
+func (t *Tracker) Save(now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, counters := range []map[string]Report{t.counters, t.saved} {
+		for key, r := range counters {
+			if t.expiry > 0 && now.Sub(r.Time) > t.expiry {
+				delete(counters, key)
+			}
+		}
+	}
+	if t.path == "" {
+		return nil
+	}
+	return atomicfile.WriteJSON(t.path, t.saved)
+}
@@ -0,0 +1,57 @@
+package cumulative
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cumulative.json")
+	now := time.Now()
+
+	tracker, err := Open(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	tests := []struct {
+		value     float64
+		time      time.Time
+		wantDelta float64
+		wantOK    bool
+	}{
+		{value: 100, time: now, wantOK: true},
+		{value: 150, time: now.Add(1 * time.Second), wantDelta: 50, wantOK: true},
+		{value: 150, time: now.Add(2 * time.Second), wantDelta: 0, wantOK: true},
+		{value: 140, time: now.Add(1 * time.Second), wantOK: false},              // out of order
+		{value: 160, time: now.Add(2 * time.Second), wantOK: false},              // duplicate
+		{value: 20, time: now.Add(3 * time.Second), wantDelta: 20, wantOK: true}, // reset
+		{value: 45, time: now.Add(4 * time.Second), wantDelta: 25, wantOK: true},
+	}
+	for _, tt := range tests {
+		delta, ok := tracker.Delta("host1:mysql:site_navbar:bytes_read", Report{Value: tt.value, Time: tt.time})
+		if delta != tt.wantDelta || ok != tt.wantOK {
+			t.Errorf("Delta(%v) = %v, %v; want %v, %v", tt.value, delta, ok, tt.wantDelta, tt.wantOK)
+		}
+	}
+	tracker.Commit(map[string]Report{
+		"host1:mysql:site_navbar:bytes_read": {Value: 20, Time: now.Add(3 * time.Second)},
+		"host2:mysql:site_navbar:bytes_read": {Value: 10, Time: now.Add(-2 * time.Hour)},
+	})
+	if err := tracker.Save(now); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	// The uncommitted report of 45 is lost with its delta,
+	// and the delta is computed from the committed report.
+	reopened, err := Open(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	if delta, ok := reopened.Delta("host1:mysql:site_navbar:bytes_read", Report{Value: 60, Time: now.Add(5 * time.Second)}); delta != 40 || !ok {
+		t.Errorf("Delta() after restart = %v, %v; want 40, true", delta, ok)
+	}
+	if delta, ok := reopened.Delta("host2:mysql:site_navbar:bytes_read", Report{Value: 20, Time: now}); delta != 0 || !ok {
+		t.Errorf("Delta() of an expired counter = %v, %v; want a new counter", delta, ok)
+	}
+}
@@ -2,17 +2,25 @@ package kusto
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/Azure/azure-kusto-go/kusto"
+	"github.com/Azure/azure-kusto-go/kusto/data/table"
+	"github.com/Azure/azure-kusto-go/kusto/data/types"
 	"github.com/Azure/azure-kusto-go/kusto/ingest"
+	"github.com/Azure/azure-kusto-go/kusto/unsafe"
 	"github.com/mykodev/myko/config"
 )
 
 type Session struct {
-	client    *ingest.Streaming
-	tableName string
+	client      *ingest.Streaming
+	queryClient *kusto.Client
+	database    string
+	tableName   string
+	mapping     string
 }
 
 func NewSession(dataConfig config.DataConfig) (*Session, error) {
@@ -29,16 +37,35 @@ func NewSession(dataConfig config.DataConfig) (*Session, error) {
 		return nil, err
 	}
 	return &Session{
-		client:    client,
-		tableName: kConfig.Table,
+		client:      client,
+		queryClient: kustoClient,
+		database:    kConfig.Database,
+		tableName:   kConfig.Table,
+		mapping:     kConfig.IngestionMapping,
 	}, nil
 }
 
+// Entry is a row of the table, see schema.kql for its schema.
 type Entry struct {
-	Target string  `json:"target,omitempty"`
-	Origin string  `json:"origin,omitempty"`
-	Event  string  `json:"event,omitempty"`
-	Value  float64 `json:"value,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target,omitempty"`
+	Origin    string    `json:"origin,omitempty"`
+	Event     string    `json:"event,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	Value     float64   `json:"value,omitempty"`
+
+	// Count is the number of observed events aggregated
+	// into the entry. Value is the estimated total if the
+	// events were sampled.
+	Count int64 `json:"count,omitempty"`
+
+	// Sketch is the serialized HyperLogLog sketch
+	// of DISTINCT events. It's stored base64 encoded.
+	Sketch []byte `json:"sketch,omitempty"`
+
+	// Decimal is the exact sum of events summed
+	// as fixed-point decimals.
+	Decimal string `json:"decimal,omitempty"`
 }
 
 func (s *Session) IngestAll(ctx context.Context, entries []*Entry) error {
@@ -56,7 +83,13 @@ func (s *Session) IngestAll(ctx context.Context, entries []*Entry) error {
 		}
 		close(errCh)
 	}()
-	result, err := s.client.FromReader(ctx, r, ingest.FileFormat(ingest.MultiJSON))
+	format := ingest.FileFormat(ingest.MultiJSON)
+	if s.mapping != "" {
+		// The entries are encoded one per line, as JSON
+		// mappings expect.
+		format = ingest.IngestionMappingRef(s.mapping, ingest.JSON)
+	}
+	result, err := s.client.FromReader(ctx, r, format)
 	if err != nil {
 		return err
 	}
@@ -69,6 +102,95 @@ func (s *Session) IngestAll(ctx context.Context, entries []*Entry) error {
 	}
 }
 
+// Query filters entries by target, origin and event name
+// in the given time range. Empty filters match all entries.
+type Query struct {
+	Target string
+	Origin string
+	Event  string
+
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+const queryFilters = `
+| where timestamp >= StartTime and timestamp < EndTime
+| where isempty(Target) or target == Target
+| where isempty(Origin) or origin == Origin
+| where isempty(Event) or event == Event
+| project timestamp, target, origin, event, kind, value, count, sketch, decimal`
+
+var queryDefinitions = kusto.NewDefinitions().Must(kusto.ParamTypes{
+	"Target":    kusto.ParamType{Type: types.String},
+	"Origin":    kusto.ParamType{Type: types.String},
+	"Event":     kusto.ParamType{Type: types.String},
+	"StartTime": kusto.ParamType{Type: types.DateTime},
+	"EndTime":   kusto.ParamType{Type: types.DateTime},
+})
+
+type row struct {
+	Timestamp time.Time `kusto:"timestamp"`
+	Target    string    `kusto:"target"`
+	Origin    string    `kusto:"origin"`
+	Event     string    `kusto:"event"`
+	Kind      string    `kusto:"kind"`
+	Value     float64   `kusto:"value"`
+	Count     int64     `kusto:"count"`
+	Sketch    string    `kusto:"sketch"`
+	Decimal   string    `kusto:"decimal"`
+}
+
+// Query returns the entries matching q.
+func (s *Session) Query(ctx context.Context, q Query) ([]*Entry, error) {
+	// Table names can't be passed as query parameters,
+	// the table name comes from the server config.
+	stmt := kusto.NewStmt("", kusto.UnsafeStmt(unsafe.Stmt{SuppressWarning: true})).
+		UnsafeAdd(s.tableName).
+		Add(queryFilters).
+		MustDefinitions(queryDefinitions)
+	stmt, err := stmt.WithParameters(kusto.NewParameters().Must(kusto.QueryValues{
+		"Target":    q.Target,
+		"Origin":    q.Origin,
+		"Event":     q.Event,
+		"StartTime": q.StartTime,
+		"EndTime":   q.EndTime,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := s.queryClient.Query(ctx, s.database, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Stop()
+
+	var entries []*Entry
+	err = iter.Do(func(r *table.Row) error {
+		var v row
+		if err := r.ToStruct(&v); err != nil {
+			return err
+		}
+		sketch, err := base64.StdEncoding.DecodeString(v.Sketch)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &Entry{
+			Timestamp: v.Timestamp,
+			Target:    v.Target,
+			Origin:    v.Origin,
+			Event:     v.Event,
+			Kind:      v.Kind,
+			Value:     v.Value,
+			Count:     v.Count,
+			Sketch:    sketch,
+			Decimal:   v.Decimal,
+		})
+		return nil
+	})
+	return entries, err
+}
+
 func (s *Session) Close() error {
 	return s.client.Close()
 }
@@ -0,0 +1,105 @@
+// Package dedup remembers the idempotency keys of inserted
+// requests, so retries are not aggregated twice.
+package dedup
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mykodev/myko/atomicfile"
+)
+
+// Keys is a set of recently seen keys. If opened with a path,
+// the committed keys are saved to the path and survive restarts.
+type Keys struct {
+	path   string
+	window time.Duration
+
+	mu    sync.Mutex // guards seen and saved
+	seen  map[string]time.Time
+	saved map[string]time.Time // committed keys
+}
+
+// Open opens a key set and loads the keys saved at path. If
+// path is empty, keys are kept only in memory. Keys are
+// forgotten once they are older than window.
+func Open(path string, window time.Duration) (*Keys, error) {
+	k := &Keys{
+		path:   path,
+		window: window,
+		seen:   make(map[string]time.Time),
+		saved:  make(map[string]time.Time),
+	}
+	if path == "" {
+		return k, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&k.saved); err != nil {
+		return nil, err
+	}
+	for key, t := range k.saved {
+		k.seen[key] = t
+	}
+	return k, nil
+}
+
+// Seen reports whether key has been added within the window.
+func (k *Keys) Seen(key string, now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	t, ok := k.seen[key]
+	return ok && now.Sub(t) <= k.window
+}
+
+// Add adds key as seen at now.
+func (k *Keys) Add(key string, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.seen[key] = now
+}
+
+// Commit marks the keys as the keys of requests whose entries
+// are written, so they are saved. Keys that are not committed
+// are forgotten after a restart, and the retries of their
+// requests are accepted again.
+func (k *Keys) Commit(keys map[string]time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for key, t := range keys {
+		k.saved[key] = t
+	}
+}
+
+// Save forgets the keys older than the window and writes the
+// committed keys to the path of the set. It is a no-op for
+// in-memory sets.
+func (k *Keys) Save(now time.Time) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, keys := range []map[string]time.Time{k.seen, k.saved} {
+		for key, t := range keys {
+			if now.Sub(t) > k.window {
+				delete(keys, key)
+			}
+		}
+	}
+	if k.path == "" {
+		return nil
+	}
+	return atomicfile.WriteJSON(k.path, k.saved)
+}
@@ -0,0 +1,44 @@
+package dedup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	now := time.Now()
+
+	keys, err := Open(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	keys.Add("old", now.Add(-2*time.Hour))
+	keys.Add("new", now)
+	keys.Add("unwritten", now)
+	keys.Commit(map[string]time.Time{"old": now.Add(-2 * time.Hour), "new": now})
+	if !keys.Seen("unwritten", now) {
+		t.Errorf("Seen(unwritten) = false, want true before a restart")
+	}
+	if err := keys.Save(now); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	keys, err = Open(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	if !keys.Seen("new", now) {
+		t.Errorf("Seen(new) = false, want true after a restart")
+	}
+	if keys.Seen("unwritten", now) {
+		t.Errorf("Seen(unwritten) = true, want false after a restart")
+	}
+	if keys.Seen("old", now) {
+		t.Errorf("Seen(old) = true, want false after the window")
+	}
+	if keys.Seen("new", now.Add(2*time.Hour)) {
+		t.Errorf("Seen(new) = true, want false after the window")
+	}
+}
@@ -2,11 +2,20 @@ package format
 
 import (
 	"errors"
+	"regexp"
 	"strings"
 
 	pb "github.com/mykodev/myko/proto"
 )
 
+var decimalRegexp = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]*)?$`)
+
+// Name makes a target, origin or event name out of an external
+// value by replacing the characters that are illegal in names.
+func Name(v string) string {
+	return strings.ReplaceAll(v, ":", "_")
+}
+
 func Verify(e *pb.Entry) error {
 	if e.Origin == "" {
 		return errors.New("entry doesn't contain an origin")
@@ -17,10 +26,31 @@ func Verify(e *pb.Entry) error {
 	if strings.ContainsRune(e.Target, ':') {
 		return errors.New("target contains illegal characters")
 	}
+	if strings.ContainsRune(e.Source, ':') {
+		return errors.New("source contains illegal characters")
+	}
 	for _, ev := range e.Events {
 		if strings.ContainsRune(ev.Name, ':') {
 			return errors.New("event name contains illegal characters")
 		}
+		if ev.SampleRate < 0 || ev.SampleRate > 1 {
+			return errors.New("event sample rate should be between 0 and 1")
+		}
+		if ev.Kind == pb.Kind_CUMULATIVE && e.Source == "" {
+			return errors.New("entry with cumulative events doesn't contain a source")
+		}
+		if ev.Kind == pb.Kind_CUMULATIVE && ev.Value < 0 {
+			return errors.New("cumulative event value is negative")
+		}
+		if ev.Kind == pb.Kind_DISTINCT && ev.Id == "" && len(ev.Sketch) == 0 {
+			return errors.New("distinct event doesn't contain an id or a sketch")
+		}
+		if ev.Decimal != "" && !decimalRegexp.MatchString(ev.Decimal) {
+			return errors.New("event decimal is malformed")
+		}
+		if ev.Kind != pb.Kind_DISTINCT && len(ev.Sketch) > 0 {
+			return errors.New("sketch is set on an event that is not distinct")
+		}
 	}
 	return nil
 }
@@ -4,8 +4,13 @@ go 1.19
 
 require (
 	github.com/Azure/azure-kusto-go v0.10.2
+	github.com/golang/snappy v0.0.4
 	github.com/montanaflynn/stats v0.6.6
 	github.com/twitchtv/twirp v8.1.3+incompatible
+	go.opentelemetry.io/proto/otlp v0.19.0
+	golang.org/x/net v0.4.0
+	google.golang.org/grpc v1.52.0
+	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.2.0
 	google.golang.org/protobuf v1.28.1
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -28,14 +33,16 @@ require (
 	github.com/cenkalti/backoff/v4 v4.2.0 // indirect
 	github.com/gofrs/uuid v4.2.0+incompatible // indirect
 	github.com/golang-jwt/jwt/v4 v4.4.3 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/uuid v1.3.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.7.0 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/pkg/browser v0.0.0-20210911075715-681adbf594b8 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/crypto v0.4.0 // indirect
-	golang.org/x/net v0.4.0 // indirect
 	golang.org/x/sys v0.3.0 // indirect
 	golang.org/x/text v0.5.0 // indirect
+	google.golang.org/genproto v0.0.0-20221118155620-16455021b5e6 // indirect
 )
 
 replace github.com/gocql/gocql v1.2.1 => github.com/scylladb/gocql v1.7.2
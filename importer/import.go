@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mykodev/myko/atomicfile"
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/format"
+	"github.com/mykodev/myko/receiver"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+const (
+	batchSize        = 1000
+	progressInterval = 10 * time.Second
+	maxLoggedRejects = 10 // per file
+)
+
+// Importer maps the rows of CSV or NDJSON files to entries and
+// writes them with a writer. The offsets of the rows written to
+// the datastore are checkpointed when the writer flushes, so an
+// interrupted import resumes where it has stopped without
+// importing a row twice.
+type Importer struct {
+	cfg    config.ImportConfig
+	mapper *receiver.Mapper
+	writer *Writer
+
+	pending     map[string]int64 // offsets of the rows given to the writer
+	checkpoints map[string]int64 // offsets of the rows written
+}
+
+func New(cfg config.ImportConfig, writer *Writer) (*Importer, error) {
+	if cfg.OriginField == "" || (cfg.Target == "" && cfg.TargetField == "") {
+		return nil, errors.New("imports need an origin field and a target or a target field")
+	}
+	if cfg.TimeField == "" {
+		return nil, errors.New("imports need a time field")
+	}
+	mapper, err := receiver.NewMapper(cfg.EntryMappingConfig, writer.exact)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := loadCheckpoints(cfg.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	i := &Importer{
+		cfg:         cfg,
+		mapper:      mapper,
+		writer:      writer,
+		pending:     make(map[string]int64),
+		checkpoints: checkpoints,
+	}
+	writer.OnFlush = i.checkpoint
+	return i, nil
+}
+
+// Import imports the rows of the file at path, starting from
+// its checkpoint. Malformed and invalid rows are logged and
+// skipped. The last rows are written once the writer is closed.
+func (i *Importer) Import(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	start := i.checkpoints[path]
+	if start >= fi.Size() {
+		log.Printf("Skipping %q, it's already imported", path)
+		return nil
+	}
+	r, err := newRowReader(i.cfg.Format, f, start)
+	if err != nil {
+		return err
+	}
+
+	var batch []*pb.Entry
+	var rows, rejected int
+	lastProgress := time.Now()
+	for ctx.Err() == nil {
+		offset := r.offset()
+		fields, err := r.read()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return err
+		}
+		var entry *pb.Entry
+		if err == nil {
+			entry, err = i.entry(fields)
+		}
+		if err == nil {
+			err = format.Verify(entry)
+		}
+		rows++
+		if err != nil {
+			if rejected++; rejected <= maxLoggedRejects {
+				log.Printf("Rejected the row at byte %d of %q: %v", offset, path, err)
+			}
+			continue
+		}
+
+		batch = append(batch, entry)
+		if len(batch) >= batchSize {
+			if err := i.insert(ctx, path, batch, r.offset()); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if time.Since(lastProgress) >= progressInterval {
+			lastProgress = time.Now()
+			log.Printf("Read %d rows of %q (%d%%), %d rejected", rows, path, 100*r.offset()/fi.Size(), rejected)
+		}
+	}
+	if err := i.insert(ctx, path, batch, r.offset()); err != nil {
+		return err
+	}
+	log.Printf("Read %d rows of %q, %d rejected", rows, path, rejected)
+	return ctx.Err()
+}
+
+// insert gives the entries read up to offset to the writer.
+// The pending offset is set first, the writer may flush and
+// checkpoint before it returns.
+func (i *Importer) insert(ctx context.Context, path string, entries []*pb.Entry, offset int64) error {
+	i.pending[path] = offset
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := i.writer.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries})
+	return err
+}
+
+// checkpoint saves the offsets of the rows given to the writer
+// once they are written.
+func (i *Importer) checkpoint() error {
+	for path, offset := range i.pending {
+		i.checkpoints[path] = offset
+	}
+	if i.cfg.Checkpoint == "" {
+		return nil
+	}
+	return saveCheckpoints(i.cfg.Checkpoint, i.checkpoints)
+}
+
+func (i *Importer) entry(fields map[string]string) (*pb.Entry, error) {
+	entry, err := i.mapper.Entry(fields)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Timestamp == nil {
+		return nil, errors.New("row doesn't contain a time")
+	}
+	return entry, nil
+}
+
+func loadCheckpoints(path string) (map[string]int64, error) {
+	checkpoints := make(map[string]int64)
+	if path == "" {
+		return checkpoints, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// saveCheckpoints writes the checkpoints to path at once, so a
+// crash never leaves a partial file behind.
+func saveCheckpoints(path string, checkpoints map[string]int64) error {
+	return atomicfile.WriteJSON(path, checkpoints)
+}
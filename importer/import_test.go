@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/receiver"
+)
+
+func TestRowReader(t *testing.T) {
+	tests := []struct {
+		format string
+		data   string
+	}{
+		{"csv", "route,duration\nsite_navbar,0.5\ncheckout,\"0.25\"\nsearch,1\n"},
+		{"ndjson", `{"route": "site_navbar", "duration": 0.5}` + "\n\n" + `{"route": "checkout", "duration": "0.25"}` + "\n" + `{"route": "search", "duration": 1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			r, err := newRowReader(tt.format, f, 0)
+			if err != nil {
+				t.Fatalf("newRowReader() = %v", err)
+			}
+			fields, err := r.read()
+			if err != nil || fields["route"] != "site_navbar" || fields["duration"] != "0.5" {
+				t.Fatalf("read() = %v, %v", fields, err)
+			}
+
+			// Resume after the first row.
+			r, err = newRowReader(tt.format, f, r.offset())
+			if err != nil {
+				t.Fatalf("newRowReader() = %v", err)
+			}
+			var routes []string
+			for {
+				fields, err := r.read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("read() = %v", err)
+				}
+				routes = append(routes, fields["route"])
+			}
+			if len(routes) != 2 || routes[0] != "checkout" || routes[1] != "search" {
+				t.Errorf("routes = %v, want [checkout search]", routes)
+			}
+			if r.offset() != int64(len(tt.data)) {
+				t.Errorf("offset() = %v, want %v", r.offset(), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestImporterEntry(t *testing.T) {
+	mapper, err := receiver.NewMapper(config.EntryMappingConfig{
+		Target:      "webserver",
+		OriginField: "route",
+		TimeField:   "time",
+		TimeLayout:  "unix_ms",
+		Events: []config.EventMappingConfig{
+			{Name: "request_count"},
+			{Name: "request_duration", Unit: "ms", Field: "duration", Scale: 1000},
+			{Name: "cost", Field: "cost"},
+		},
+	}, map[string]int{"cost": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Importer{mapper: mapper}
+	entry, err := i.entry(map[string]string{
+		"route":    "site_navbar",
+		"time":     "1673352000123",
+		"duration": "0.5",
+		"cost":     "0.0003",
+	})
+	if err != nil {
+		t.Fatalf("entry() = %v", err)
+	}
+	if entry.Target != "webserver" || entry.Origin != "site_navbar" {
+		t.Errorf("entry = %v/%v, want webserver/site_navbar", entry.Target, entry.Origin)
+	}
+	if got := entry.Timestamp.AsTime().UnixMilli(); got != 1673352000123 {
+		t.Errorf("timestamp = %v, want 1673352000123", got)
+	}
+	if ev := entry.Events[1]; ev.Name != "request_duration_ms" || ev.Value != 500 {
+		t.Errorf("event = %v %v, want request_duration_ms 500", ev.Name, ev.Value)
+	}
+	if ev := entry.Events[2]; ev.Decimal != "0.0003" {
+		t.Errorf("cost decimal = %q, want 0.0003", ev.Decimal)
+	}
+
+	if _, err := i.entry(map[string]string{"route": "site_navbar", "time": "yesterday"}); err == nil {
+		t.Errorf("entry() with a malformed time = nil error")
+	}
+	if _, err := i.entry(map[string]string{"route": "site_navbar"}); err == nil {
+		t.Errorf("entry() without a time = nil error")
+	}
+}
@@ -0,0 +1,141 @@
+// Package importer writes entries of offline imports straight
+// to the datastore, bypassing the server and its tolerance for
+// late entries.
+package importer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mykodev/myko/aggregator"
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/datastore/kusto"
+	"github.com/mykodev/myko/format"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Writer aggregates entries into windows of the flush interval
+// as the server does and writes them to the datastore once the
+// buffer is full or Flush is called. Unlike the server, it
+// accepts entries of any time.
+type Writer struct {
+	// OnFlush, if set, is called after the windows are written,
+	// e.g. to checkpoint the progress of an import.
+	OnFlush func() error
+
+	session    *kusto.Session
+	interval   time.Duration
+	bufferSize int
+	exact      map[string]int
+
+	windows map[time.Time]*aggregator.Summer
+	size    int
+}
+
+// NewWriter returns a writer that writes to the datastore
+// of the server config.
+func NewWriter(cfg config.Config) (*Writer, error) {
+	session, err := kusto.NewSession(cfg.DataConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		session:    session,
+		interval:   cfg.FlushConfig.Interval,
+		bufferSize: cfg.FlushConfig.BufferSize,
+		exact:      cfg.AggregationConfig.Exact,
+		windows:    make(map[time.Time]*aggregator.Summer),
+	}, nil
+}
+
+// InsertEvents verifies and aggregates the entries. Entries
+// without a timestamp are aggregated into the current window.
+// Cumulative events are rejected, imports need to report deltas.
+// It is not safe for concurrent use.
+func (w *Writer) InsertEvents(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error) {
+	for _, entry := range req.Entries {
+		if err := format.Verify(entry); err != nil {
+			return nil, err
+		}
+		for _, ev := range entry.Events {
+			if ev.Kind == pb.Kind_CUMULATIVE {
+				return nil, errors.New("cumulative events can't be imported")
+			}
+			if err := aggregator.Verify(ev, w.exact); err != nil {
+				return nil, err
+			}
+		}
+	}
+	now := time.Now()
+	for _, entry := range req.Entries {
+		ts := now
+		if entry.Timestamp != nil {
+			ts = entry.Timestamp.AsTime()
+		}
+		start := ts.Truncate(w.interval)
+		summer, ok := w.windows[start]
+		if !ok {
+			summer = aggregator.NewSummer(0).Exact(w.exact)
+			w.windows[start] = summer
+		}
+		for _, ev := range entry.Events {
+			before := summer.Size()
+			if err := summer.Add(entry.Target, entry.Origin, ev); err != nil {
+				return nil, err
+			}
+			w.size += summer.Size() - before
+		}
+	}
+	if w.size >= w.bufferSize {
+		if err := w.Flush(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &pb.InsertEventsResponse{Accepted: uint32(len(req.Entries))}, nil
+}
+
+// Flush writes all windows to the datastore at once. Windows
+// that receive more entries later are written again as additional
+// data points of the same window.
+func (w *Writer) Flush(ctx context.Context) error {
+	kEntries := make([]*kusto.Entry, 0, w.size)
+	for start, summer := range w.windows {
+		start := start
+		summer.ForEach(func(target, origin string, ev *pb.Event) {
+			kEntries = append(kEntries, &kusto.Entry{
+				Timestamp: start,
+				Target:    target,
+				Origin:    origin,
+				Event:     ev.Name,
+				Kind:      ev.Kind.String(),
+				Value:     ev.Value,
+				Count:     int64(ev.Count),
+				Sketch:    ev.Sketch,
+				Decimal:   ev.Decimal,
+			})
+		})
+	}
+	if len(kEntries) > 0 {
+		log.Printf("Writing %d events of %d windows", len(kEntries), len(w.windows))
+		if err := w.session.IngestAll(ctx, kEntries); err != nil {
+			return err
+		}
+	}
+	w.windows = make(map[time.Time]*aggregator.Summer)
+	w.size = 0
+	if w.OnFlush != nil {
+		return w.OnFlush()
+	}
+	return nil
+}
+
+// Close flushes the remaining windows and closes the session.
+func (w *Writer) Close() error {
+	if err := w.Flush(context.Background()); err != nil {
+		return err
+	}
+	return w.session.Close()
+}
@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rowReader reads the rows of a file as fields by column name.
+// Offset is the offset of the end of the last read row.
+type rowReader interface {
+	read() (fields map[string]string, err error)
+	offset() int64
+}
+
+// rowError is a malformed row. Reading can continue
+// with the next row.
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+// newRowReader returns a reader reading f from the given offset.
+func newRowReader(format string, f *os.File, offset int64) (rowReader, error) {
+	switch format {
+	case "csv":
+		return newCSVReader(f, offset)
+	case "ndjson":
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return &ndjsonReader{r: bufio.NewReader(f), off: offset}, nil
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+	base   int64 // offset the reader has started at
+}
+
+// newCSVReader reads the header at the beginning of f and
+// continues from the offset if it's past the header.
+func newCSVReader(f *os.File, offset int64) (*csvReader, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file doesn't contain a header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offset <= r.InputOffset() {
+		return &csvReader{r: r, header: header}, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r = csv.NewReader(f)
+	r.FieldsPerRecord = len(header)
+	return &csvReader{r: r, header: header, base: offset}, nil
+}
+
+func (c *csvReader) read() (map[string]string, error) {
+	record, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, &rowError{err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(record))
+	for i, v := range record {
+		fields[c.header[i]] = v
+	}
+	return fields, nil
+}
+
+func (c *csvReader) offset() int64 {
+	return c.base + c.r.InputOffset()
+}
+
+// ndjsonReader reads the top-level fields of JSON objects,
+// one object per line. Nested objects and arrays are kept
+// as JSON.
+type ndjsonReader struct {
+	r   *bufio.Reader
+	off int64
+}
+
+func (n *ndjsonReader) read() (map[string]string, error) {
+	for {
+		line, err := n.r.ReadBytes('\n')
+		n.off += int64(len(line))
+		if err == io.EOF && len(line) > 0 {
+			err = nil // the last line without a newline
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(line, &obj); err != nil {
+			return nil, &rowError{err: err}
+		}
+		fields := make(map[string]string, len(obj))
+		for k, v := range obj {
+			var s string
+			if err := json.Unmarshal(v, &s); err == nil {
+				fields[k] = s
+			} else {
+				fields[k] = string(v)
+			}
+		}
+		return fields, nil
+	}
+}
+
+func (n *ndjsonReader) offset() int64 {
+	return n.off
+}
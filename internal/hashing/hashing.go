@@ -0,0 +1,20 @@
+// Package hashing hashes strings evenly and stably across
+// processes, e.g. for sketches and consistent hashing.
+package hashing
+
+import "hash/fnv"
+
+// String hashes s with FNV-1a and mixes the result with the
+// murmur3 finalizer. FNV hashes of similar strings are close
+// to each other, the mixing spreads the bits evenly.
+func String(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,39 @@
+// Package wire decodes protobuf messages field by field, for
+// the formats whose generated types are not worth depending on.
+package wire
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrMalformed is returned for messages that are not
+// valid protobuf.
+var ErrMalformed = errors.New("malformed protobuf message")
+
+// ParseMessage calls fn with the raw value of every field in b.
+// Values of length-delimited fields are passed without their
+// length prefix.
+func ParseMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrMalformed
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return ErrMalformed
+		}
+		v := b[:n]
+		if typ == protowire.BytesType {
+			v, _ = protowire.ConsumeBytes(v)
+		}
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
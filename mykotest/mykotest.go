@@ -0,0 +1,134 @@
+// Package mykotest provides fakes of the myko service and
+// of the datastore for tests.
+package mykotest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mykodev/myko/datastore/kusto"
+	"github.com/twitchtv/twirp"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Service is a fake service recording the inserted requests.
+// It is safe for concurrent use.
+type Service struct {
+	// Reject, if set, returns the reason entries are rejected
+	// for, or an empty string if they are accepted. Requests
+	// with rejected entries fail unless they are partial.
+	Reject func(e *pb.Entry) string
+
+	mu      sync.Mutex
+	reqs    []*pb.InsertEventsRequest
+	entries []*pb.Entry
+	err     error
+}
+
+// Fail makes the next inserts fail with err until it's
+// called with nil.
+func (s *Service) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// InsertEvents records req and its accepted entries.
+func (s *Service) InsertEvents(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	resp := &pb.InsertEventsResponse{}
+	var accepted []*pb.Entry
+	for i, e := range req.Entries {
+		if s.Reject != nil {
+			if reason := s.Reject(e); reason != "" {
+				if !req.Partial {
+					return nil, twirp.NewError(twirp.InvalidArgument, reason)
+				}
+				resp.Rejections = append(resp.Rejections, &pb.Rejection{Index: uint32(i), Reason: reason})
+				continue
+			}
+		}
+		accepted = append(accepted, e)
+	}
+	s.reqs = append(s.reqs, req)
+	s.entries = append(s.entries, accepted...)
+	resp.Accepted = uint32(len(accepted))
+	resp.Rejected = uint32(len(resp.Rejections))
+	return resp, nil
+}
+
+// Query is not implemented.
+func (s *Service) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
+	return nil, twirp.NewError(twirp.Unimplemented, "queries are not implemented")
+}
+
+// Requests returns the inserted requests.
+func (s *Service) Requests() []*pb.InsertEventsRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pb.InsertEventsRequest(nil), s.reqs...)
+}
+
+// Entries returns the accepted entries of the inserted requests.
+func (s *Service) Entries() []*pb.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pb.Entry(nil), s.entries...)
+}
+
+// Datastore is a fake datastore keeping the ingested entries
+// in memory. It is safe for concurrent use.
+type Datastore struct {
+	// OnQuery, if set, is called by Query before
+	// the entries are read.
+	OnQuery func()
+
+	mu      sync.Mutex
+	entries []*kusto.Entry
+}
+
+// IngestAll appends entries to the datastore.
+func (d *Datastore) IngestAll(ctx context.Context, entries []*kusto.Entry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, entries...)
+	return nil
+}
+
+// Query returns the entries matching q.
+func (d *Datastore) Query(ctx context.Context, q kusto.Query) ([]*kusto.Entry, error) {
+	if d.OnQuery != nil {
+		d.OnQuery()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var entries []*kusto.Entry
+	for _, e := range d.entries {
+		if (q.Target != "" && e.Target != q.Target) ||
+			(q.Origin != "" && e.Origin != q.Origin) ||
+			(q.Event != "" && e.Event != q.Event) ||
+			(!q.StartTime.IsZero() && e.Timestamp.Before(q.StartTime)) ||
+			(!q.EndTime.IsZero() && !e.Timestamp.Before(q.EndTime)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Entries returns the ingested entries.
+func (d *Datastore) Entries() []*kusto.Entry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*kusto.Entry(nil), d.entries...)
+}
+
+// Close is a no-op.
+func (d *Datastore) Close() error {
+	return nil
+}
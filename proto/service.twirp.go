@@ -924,9 +924,12 @@ func sanitizeBaseURL(baseURL string) string {
 
 // baseServicePath composes the path prefix for the service (without <Method>).
 // e.g.: baseServicePath("/twirp", "my.pkg", "MyService")
-//       returns => "/twirp/my.pkg.MyService/"
+//
+//	returns => "/twirp/my.pkg.MyService/"
+//
 // e.g.: baseServicePath("", "", "MyService")
-//       returns => "/MyService/"
+//
+//	returns => "/MyService/"
 func baseServicePath(prefix, pkg, service string) string {
 	fullServiceName := service
 	if pkg != "" {
@@ -1364,26 +1367,49 @@ func callClientError(ctx context.Context, h *twirp.ClientHooks, err twirp.Error)
 }
 
 var twirpFileDescriptor0 = []byte{
-	// 334 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x52, 0xcd, 0x4b, 0xfb, 0x40,
-	0x10, 0x25, 0xbf, 0x26, 0xed, 0xaf, 0xd3, 0x0a, 0xb2, 0x2d, 0x25, 0xe6, 0x62, 0x89, 0x08, 0x15,
-	0x21, 0xd1, 0xea, 0x4d, 0x4f, 0x42, 0x0f, 0x7a, 0x33, 0x7a, 0xf2, 0x96, 0xd4, 0x31, 0x06, 0x9b,
-	0xdd, 0xb8, 0xbb, 0x09, 0xf4, 0xea, 0x5f, 0x2e, 0x99, 0xdd, 0x42, 0x2b, 0xf5, 0xe0, 0x25, 0xd9,
-	0xf7, 0x66, 0xde, 0x47, 0x3e, 0x60, 0x54, 0x49, 0xa1, 0x45, 0xac, 0x50, 0x36, 0xc5, 0x12, 0x23,
-	0x42, 0xcc, 0x2d, 0xd7, 0x1f, 0x22, 0x38, 0xce, 0x85, 0xc8, 0x57, 0x18, 0x13, 0x97, 0xd5, 0x6f,
-	0xb1, 0x2e, 0x4a, 0x54, 0x3a, 0x2d, 0x2b, 0xb3, 0x16, 0x5e, 0x82, 0xb7, 0x68, 0x90, 0x6b, 0xc6,
-	0xc0, 0xe5, 0x69, 0x89, 0xbe, 0x33, 0x75, 0x66, 0xfd, 0x84, 0xce, 0x6c, 0x0c, 0x5e, 0x93, 0xae,
-	0x6a, 0xf4, 0xff, 0x4d, 0x9d, 0x99, 0x93, 0x18, 0x10, 0x66, 0xe0, 0x2d, 0xb8, 0x96, 0x6b, 0x36,
-	0x81, 0xae, 0x4e, 0x65, 0x8e, 0xda, 0x8a, 0x2c, 0x6a, 0x79, 0x21, 0x8b, 0xbc, 0xe0, 0xa4, 0xeb,
-	0x27, 0x16, 0xb1, 0x13, 0xe8, 0x62, 0x9b, 0xa5, 0x7c, 0x77, 0xda, 0x99, 0x0d, 0xe6, 0x83, 0xa8,
-	0xed, 0x18, 0x51, 0x7e, 0x62, 0x47, 0x0f, 0xee, 0xff, 0xce, 0xa1, 0x1b, 0x3e, 0xc3, 0xf0, 0xb1,
-	0x46, 0xb9, 0x4e, 0xf0, 0xb3, 0x46, 0xa5, 0xff, 0x1c, 0x35, 0x06, 0x8f, 0xfc, 0xfc, 0x0e, 0xd1,
-	0x06, 0x84, 0xd7, 0x70, 0x60, 0x5d, 0x55, 0x25, 0xb8, 0xc2, 0xad, 0x46, 0xce, 0xaf, 0x8d, 0xc2,
-	0x5b, 0x18, 0xdd, 0x73, 0x85, 0x52, 0x13, 0xad, 0x36, 0x95, 0x4e, 0xa1, 0x87, 0x5c, 0xcb, 0x02,
-	0x7f, 0x8a, 0xdb, 0x77, 0x93, 0x6c, 0x66, 0xe1, 0x04, 0xc6, 0xbb, 0x6a, 0x13, 0x3d, 0xff, 0x72,
-	0xa0, 0xf7, 0x64, 0xbe, 0x18, 0xbb, 0x00, 0x8f, 0x7a, 0x31, 0x66, 0x2c, 0xb6, 0x1f, 0x3d, 0x18,
-	0xed, 0x70, 0xb6, 0xf8, 0x02, 0x86, 0xdb, 0xae, 0xec, 0xc8, 0x2c, 0xed, 0xe9, 0x19, 0x04, 0xfb,
-	0x46, 0xc6, 0xe6, 0xee, 0xfc, 0xe5, 0x2c, 0x2f, 0xf4, 0x7b, 0x9d, 0x45, 0x4b, 0x51, 0xc6, 0xed,
-	0xde, 0x2b, 0x36, 0x74, 0x37, 0x7f, 0x0c, 0x1d, 0x6f, 0xda, 0x4b, 0x95, 0x65, 0x5d, 0xa2, 0xae,
-	0xbe, 0x03, 0x00, 0x00, 0xff, 0xff, 0xa3, 0xdc, 0x3f, 0xdd, 0x6f, 0x02, 0x00, 0x00,
+	// 695 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0x4d, 0x6f, 0xd3, 0x4a,
+	0x14, 0x7d, 0x4e, 0x9c, 0xc4, 0xb9, 0x49, 0xd3, 0x68, 0x5a, 0x3d, 0xf9, 0x45, 0x4f, 0xaf, 0x51,
+	0x9e, 0x2a, 0x02, 0x88, 0x04, 0x05, 0x90, 0xa8, 0x58, 0x95, 0xd2, 0x45, 0x28, 0x45, 0x62, 0x9a,
+	0xb2, 0x60, 0x13, 0x4d, 0xec, 0x5b, 0x77, 0x48, 0xfc, 0xc1, 0x78, 0x1c, 0xc8, 0x96, 0xff, 0xc1,
+	0xbf, 0xe0, 0x27, 0x20, 0x16, 0xfc, 0x2a, 0x34, 0x33, 0x76, 0x9a, 0xa2, 0xa2, 0x8a, 0x4d, 0x32,
+	0xe7, 0xdc, 0x3b, 0x9e, 0x7b, 0xce, 0x1c, 0x1b, 0x76, 0x12, 0x11, 0xcb, 0x78, 0x98, 0xa2, 0x58,
+	0x72, 0x0f, 0x07, 0x1a, 0x11, 0x3b, 0x5c, 0xcd, 0xe3, 0xce, 0x5e, 0x10, 0xc7, 0xc1, 0x02, 0x87,
+	0x9a, 0x9b, 0x65, 0x17, 0x43, 0xc9, 0x43, 0x4c, 0x25, 0x0b, 0x13, 0xd3, 0xd6, 0xfb, 0x61, 0x41,
+	0xe5, 0x78, 0x89, 0x91, 0x24, 0x04, 0xec, 0x88, 0x85, 0xe8, 0x5a, 0x5d, 0xab, 0x5f, 0xa7, 0x7a,
+	0x4d, 0x76, 0xa1, 0xb2, 0x64, 0x8b, 0x0c, 0xdd, 0x52, 0xd7, 0xea, 0x5b, 0xd4, 0x00, 0xf2, 0x1f,
+	0xd8, 0x73, 0x1e, 0xf9, 0x6e, 0xb9, 0x6b, 0xf5, 0x5b, 0x23, 0x18, 0xa8, 0x93, 0x06, 0x27, 0x3c,
+	0xf2, 0xa9, 0xe6, 0x49, 0x0b, 0x4a, 0xdc, 0x77, 0x6d, 0xfd, 0x9c, 0x12, 0xf7, 0xc9, 0xdf, 0x50,
+	0x4d, 0xe7, 0x28, 0xbd, 0x4b, 0xb7, 0xd2, 0xb5, 0xfa, 0x4d, 0x9a, 0x23, 0xe2, 0x42, 0xcd, 0x47,
+	0x8f, 0x87, 0x6c, 0xe1, 0x56, 0x75, 0x73, 0x01, 0xc9, 0x1e, 0x34, 0x52, 0x16, 0x26, 0x0b, 0x9c,
+	0x0a, 0x26, 0xd1, 0xad, 0xe9, 0xd3, 0xc1, 0x50, 0x94, 0x49, 0x3d, 0x98, 0x17, 0x67, 0x91, 0x74,
+	0x9d, 0xae, 0xd5, 0xb7, 0xa9, 0x01, 0xbd, 0xaf, 0x4a, 0x4c, 0x24, 0xc5, 0x4a, 0x1d, 0x29, 0x99,
+	0x08, 0x50, 0xe6, 0x72, 0x72, 0xa4, 0xf8, 0x58, 0xf0, 0x80, 0x47, 0x5a, 0x51, 0x9d, 0xe6, 0x88,
+	0xfc, 0x0f, 0x55, 0x54, 0x2e, 0xa4, 0xae, 0xdd, 0x2d, 0xf7, 0x1b, 0xa3, 0x86, 0x11, 0xa5, 0x9d,
+	0xa1, 0x79, 0x89, 0x3c, 0x85, 0xfa, 0xda, 0x3e, 0x2d, 0xa5, 0x31, 0xea, 0x0c, 0x8c, 0xc1, 0x83,
+	0xc2, 0xe0, 0xc1, 0xa4, 0xe8, 0xa0, 0x57, 0xcd, 0xda, 0x81, 0x38, 0x13, 0x1e, 0xe6, 0x42, 0x73,
+	0xf4, 0xd2, 0x76, 0xca, 0x6d, 0xbb, 0xf7, 0xdd, 0x82, 0xe6, 0x9b, 0x0c, 0xc5, 0x8a, 0xe2, 0x87,
+	0x0c, 0x53, 0xf9, 0xc7, 0xd3, 0xef, 0x42, 0x45, 0x8f, 0xa8, 0x6f, 0xa4, 0x4e, 0x0d, 0x20, 0x07,
+	0x00, 0xa9, 0x64, 0x42, 0x4e, 0xd5, 0x1c, 0xae, 0x7d, 0xfb, 0xbc, 0xba, 0x5b, 0x61, 0xf2, 0x04,
+	0x1c, 0x8c, 0x7c, 0xb3, 0xf1, 0x76, 0xa1, 0x35, 0x8c, 0x7c, 0x85, 0x7a, 0x8f, 0x61, 0x2b, 0xd7,
+	0x91, 0x26, 0x71, 0x94, 0xe2, 0x86, 0xad, 0xd6, 0x6f, 0x6d, 0xed, 0x7d, 0xb3, 0x60, 0x67, 0x1c,
+	0xa5, 0x28, 0xa4, 0xe6, 0xd3, 0xc2, 0x85, 0x7d, 0xa8, 0x61, 0x24, 0x05, 0xc7, 0x5f, 0x77, 0xab,
+	0x1b, 0xa6, 0x45, 0x4d, 0xa5, 0x28, 0x61, 0x42, 0x72, 0xb6, 0xd0, 0xae, 0x38, 0xb4, 0x80, 0xe4,
+	0x0e, 0x6c, 0x73, 0x1f, 0xc3, 0x24, 0x96, 0x18, 0x79, 0xab, 0xe9, 0x1c, 0x57, 0xb9, 0x41, 0xad,
+	0x0d, 0xfa, 0x04, 0x57, 0xe4, 0x5f, 0xa8, 0x5f, 0xc4, 0xe2, 0x23, 0x13, 0x3e, 0x9a, 0xdc, 0x3a,
+	0xf4, 0x8a, 0x20, 0xfb, 0xd0, 0x4a, 0x04, 0x4e, 0x59, 0x10, 0x08, 0x0c, 0x98, 0x44, 0x5f, 0x5b,
+	0xe2, 0xd0, 0xad, 0x44, 0xe0, 0xe1, 0x9a, 0xec, 0x7d, 0xb1, 0x60, 0xf7, 0xba, 0x8c, 0xdc, 0x84,
+	0x0e, 0x38, 0xcc, 0xf3, 0x30, 0x51, 0x3b, 0xd5, 0x7d, 0x6e, 0xd1, 0x35, 0x56, 0x35, 0x81, 0xef,
+	0xd1, 0x53, 0xb5, 0x92, 0xa9, 0x15, 0x98, 0x0c, 0x01, 0xcc, 0x9a, 0xc7, 0x51, 0xea, 0x96, 0xb5,
+	0x05, 0xdb, 0xc6, 0x02, 0x5a, 0xf0, 0x74, 0xa3, 0x45, 0xc9, 0xf0, 0xb3, 0x64, 0xc1, 0x3d, 0xf5,
+	0xce, 0xe4, 0x32, 0xd6, 0x44, 0xef, 0x00, 0xea, 0xeb, 0x6d, 0x2a, 0x31, 0x3c, 0xf2, 0xf1, 0x53,
+	0x3e, 0x90, 0x01, 0x2a, 0x5f, 0x02, 0x59, 0x1a, 0xaf, 0xf3, 0x65, 0xd0, 0xbd, 0x07, 0x60, 0xab,
+	0xd7, 0x9b, 0xd4, 0xa0, 0x7c, 0x76, 0x7e, 0xda, 0xfe, 0x8b, 0x34, 0xc1, 0x79, 0x31, 0x3e, 0x9b,
+	0x8c, 0x5f, 0x1f, 0x4d, 0xda, 0x16, 0x69, 0x01, 0x1c, 0x9d, 0x9f, 0x9e, 0xbf, 0x3a, 0x9c, 0x8c,
+	0xdf, 0x1e, 0xb7, 0x4b, 0xa3, 0xcf, 0x16, 0xd4, 0xce, 0xcc, 0xc7, 0x88, 0x3c, 0x84, 0x8a, 0x8e,
+	0x04, 0x21, 0x66, 0xf2, 0xcd, 0x9c, 0x77, 0x76, 0xae, 0x71, 0xb9, 0x5d, 0xc7, 0xd0, 0xdc, 0xb4,
+	0x91, 0xfc, 0x63, 0x9a, 0x6e, 0x48, 0x48, 0xa7, 0x73, 0x53, 0xc9, 0x3c, 0xe6, 0xf9, 0xfd, 0x77,
+	0x77, 0x03, 0x2e, 0x2f, 0xb3, 0xd9, 0xc0, 0x8b, 0xc3, 0xa1, 0xea, 0xf3, 0x71, 0xa9, 0xff, 0xcd,
+	0xc7, 0x50, 0x2f, 0x9f, 0xa9, 0x9f, 0x64, 0x36, 0xab, 0x6a, 0xea, 0xd1, 0xcf, 0x01, 0x00, 0x53,
+	0x54, 0x7a, 0x05, 0x4a, 0x05, 0x00, 0x00,
 }
@@ -0,0 +1,143 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.7
+// source: proto/stream.proto
+
+package mykopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// StreamServiceClient is the client API for StreamService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type StreamServiceClient interface {
+	// InsertEventsStream inserts the entries of a stream of requests.
+	// It is intended for long-lived producers with high throughput.
+	// The response is sent once the client closes the stream.
+	InsertEventsStream(ctx context.Context, opts ...grpc.CallOption) (StreamService_InsertEventsStreamClient, error)
+}
+
+type streamServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStreamServiceClient(cc grpc.ClientConnInterface) StreamServiceClient {
+	return &streamServiceClient{cc}
+}
+
+func (c *streamServiceClient) InsertEventsStream(ctx context.Context, opts ...grpc.CallOption) (StreamService_InsertEventsStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &StreamService_ServiceDesc.Streams[0], "/myko.StreamService/InsertEventsStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &streamServiceInsertEventsStreamClient{stream}
+	return x, nil
+}
+
+type StreamService_InsertEventsStreamClient interface {
+	Send(*InsertEventsRequest) error
+	CloseAndRecv() (*InsertEventsResponse, error)
+	grpc.ClientStream
+}
+
+type streamServiceInsertEventsStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *streamServiceInsertEventsStreamClient) Send(m *InsertEventsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *streamServiceInsertEventsStreamClient) CloseAndRecv() (*InsertEventsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(InsertEventsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// StreamServiceServer is the server API for StreamService service.
+// All implementations should embed UnimplementedStreamServiceServer
+// for forward compatibility
+type StreamServiceServer interface {
+	// InsertEventsStream inserts the entries of a stream of requests.
+	// It is intended for long-lived producers with high throughput.
+	// The response is sent once the client closes the stream.
+	InsertEventsStream(StreamService_InsertEventsStreamServer) error
+}
+
+// UnimplementedStreamServiceServer should be embedded to have forward compatible implementations.
+type UnimplementedStreamServiceServer struct {
+}
+
+func (UnimplementedStreamServiceServer) InsertEventsStream(StreamService_InsertEventsStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method InsertEventsStream not implemented")
+}
+
+// UnsafeStreamServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StreamServiceServer will
+// result in compilation errors.
+type UnsafeStreamServiceServer interface {
+	mustEmbedUnimplementedStreamServiceServer()
+}
+
+func RegisterStreamServiceServer(s grpc.ServiceRegistrar, srv StreamServiceServer) {
+	s.RegisterService(&StreamService_ServiceDesc, srv)
+}
+
+func _StreamService_InsertEventsStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(StreamServiceServer).InsertEventsStream(&streamServiceInsertEventsStreamServer{stream})
+}
+
+type StreamService_InsertEventsStreamServer interface {
+	SendAndClose(*InsertEventsResponse) error
+	Recv() (*InsertEventsRequest, error)
+	grpc.ServerStream
+}
+
+type streamServiceInsertEventsStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *streamServiceInsertEventsStreamServer) SendAndClose(m *InsertEventsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *streamServiceInsertEventsStreamServer) Recv() (*InsertEventsRequest, error) {
+	m := new(InsertEventsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// StreamService_ServiceDesc is the grpc.ServiceDesc for StreamService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var StreamService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "myko.StreamService",
+	HandlerType: (*StreamServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "InsertEventsStream",
+			Handler:       _StreamService_InsertEventsStream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/stream.proto",
+}
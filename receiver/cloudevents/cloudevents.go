@@ -0,0 +1,217 @@
+// Package cloudevents receives CloudEvents over HTTP and
+// converts them into entries.
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/receiver"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+const maxBodySize = 4 << 20
+
+type Receiver struct {
+	cfg      config.CloudEventsConfig
+	mappers  map[string]*receiver.Mapper // by event type
+	inserter receiver.Inserter
+}
+
+func New(cfg config.CloudEventsConfig, inserter receiver.Inserter) (*Receiver, error) {
+	if cfg.Path == "" {
+		cfg.Path = "/cloudevents"
+	}
+	mappers := make(map[string]*receiver.Mapper, len(cfg.Mappings))
+	for _, mc := range cfg.Mappings {
+		if mc.OriginField == "" {
+			mc.OriginField = "source"
+		}
+		if mc.TimeField == "" {
+			mc.TimeField = "time"
+		}
+		m, err := receiver.NewMapper(mc.EntryMappingConfig, nil)
+		if err != nil {
+			return nil, fmt.Errorf("mapping of %q: %w", mc.Type, err)
+		}
+		mappers[mc.Type] = m
+	}
+	return &Receiver{cfg: cfg, mappers: mappers, inserter: inserter}, nil
+}
+
+// Path returns the HTTP path the receiver needs to be served at.
+func (r *Receiver) Path() string {
+	return r.cfg.Path
+}
+
+// ServeHTTP accepts events in binary mode, where the context
+// attributes are ce- headers and the body is the data, and in
+// structured and batched JSON modes. Events that can't be mapped
+// or inserted are rejected without failing the rest of the batch,
+// the rejections are reported in the response by event index.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	var events []map[string]string
+	switch mediaType {
+	case "application/cloudevents+json":
+		var ev map[string]json.RawMessage
+		if err = json.Unmarshal(b, &ev); err == nil {
+			events = append(events, structuredFields(ev))
+		}
+	case "application/cloudevents-batch+json":
+		var batch []map[string]json.RawMessage
+		if err = json.Unmarshal(b, &batch); err == nil {
+			for _, ev := range batch {
+				events = append(events, structuredFields(ev))
+			}
+		}
+	default:
+		var fields map[string]string
+		if fields, err = binaryFields(req.Header, mediaType, b); err == nil {
+			events = append(events, fields)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var entries []*pb.Entry
+	var indexes []int // of the events of the entries
+	var rejections []rejection
+	var accepted int
+	for i, fields := range events {
+		m, ok := r.mappers[fields["type"]]
+		if !ok {
+			continue
+		}
+		entry, err := m.Entry(fields)
+		if err != nil {
+			rejections = append(rejections, rejection{Index: i, Reason: fmt.Sprintf("event of type %q: %v", fields["type"], err)})
+			continue
+		}
+		entries = append(entries, entry)
+		indexes = append(indexes, i)
+	}
+	if len(entries) > 0 {
+		// Late or invalid events are rejected without
+		// failing the rest of the batch.
+		resp, err := r.inserter.InsertEvents(req.Context(), &pb.InsertEventsRequest{Entries: entries, Partial: true})
+		if err != nil {
+			// Senders retry 5xx responses.
+			http.Error(w, err.Error(), receiver.StatusCode(err))
+			return
+		}
+		accepted = len(entries) - len(resp.Rejections)
+		for _, rj := range resp.Rejections {
+			if int(rj.Index) < len(indexes) {
+				rejections = append(rejections, rejection{Index: indexes[rj.Index], Reason: rj.Reason})
+			}
+		}
+	}
+	if len(rejections) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	log.Printf("Rejected %d CloudEvents: %v", len(rejections), rejections[0].Reason)
+	status := http.StatusAccepted
+	if accepted == 0 {
+		// Invalid events won't succeed on retry.
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]rejection{"rejections": rejections})
+}
+
+// rejection reports an event of a request that is rejected,
+// by its index in the batch.
+type rejection struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// binaryFields returns the fields of an event in binary mode.
+func binaryFields(h http.Header, mediaType string, body []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	for k, v := range h {
+		if name := strings.ToLower(k); strings.HasPrefix(name, "ce-") && len(v) > 0 {
+			fields[name[len("ce-"):]] = v[0]
+		}
+	}
+	if fields["specversion"] == "" {
+		return nil, errors.New("request is not a CloudEvent, ce-specversion is missing")
+	}
+	if len(body) > 0 && isJSON(mediaType) {
+		if err := flatten(fields, "data", body); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// structuredFields returns the fields of an event in
+// structured mode. Only JSON data is mapped to fields.
+func structuredFields(ev map[string]json.RawMessage) map[string]string {
+	fields := make(map[string]string)
+	for k, v := range ev {
+		if k == "data" || k == "data_base64" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			fields[k] = s
+		} else {
+			fields[k] = string(v)
+		}
+	}
+	if data, ok := ev["data"]; ok {
+		// Non-JSON data is a JSON string, which has no fields.
+		flatten(fields, "data", data)
+	}
+	return fields
+}
+
+// flatten sets the fields of nested objects with their
+// dot-separated paths, e.g. data.user.id.
+func flatten(fields map[string]string, prefix string, v json.RawMessage) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(v, &obj); err == nil {
+		for k, v := range obj {
+			flatten(fields, prefix+"."+k, v)
+		}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		fields[prefix] = s
+		return nil
+	}
+	if !json.Valid(v) {
+		return fmt.Errorf("malformed JSON data")
+	}
+	fields[prefix] = string(v)
+	return nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
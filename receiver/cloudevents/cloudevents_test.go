@@ -0,0 +1,179 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/mykotest"
+	"github.com/twitchtv/twirp"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestReceiver(t *testing.T) {
+	cfg := config.CloudEventsConfig{
+		Mappings: []config.CloudEventMappingConfig{{
+			Type: "com.example.order.created",
+			EntryMappingConfig: config.EntryMappingConfig{
+				TargetField: "subject",
+				OriginField: "data.route",
+				Events: []config.EventMappingConfig{
+					{Name: "order_count"},
+					{Name: "order_total", Field: "data.order.total"},
+				},
+			},
+		}},
+	}
+	tests := []struct {
+		name    string
+		header  map[string]string
+		body    string
+		entries int
+	}{
+		{
+			name: "binary",
+			header: map[string]string{
+				"Content-Type":   "application/json",
+				"Ce-Specversion": "1.0",
+				"Ce-Type":        "com.example.order.created",
+				"Ce-Source":      "/checkout",
+				"Ce-Id":          "1",
+				"Ce-Subject":     "orders",
+				"Ce-Time":        "2023-01-10T12:00:00Z",
+			},
+			body:    `{"route": "checkout", "order": {"total": 12.5}}`,
+			entries: 1,
+		},
+		{
+			name:    "structured",
+			header:  map[string]string{"Content-Type": "application/cloudevents+json; charset=utf-8"},
+			body:    `{"specversion": "1.0", "type": "com.example.order.created", "source": "/checkout", "id": "1", "subject": "orders", "time": "2023-01-10T12:00:00Z", "data": {"route": "checkout", "order": {"total": 12.5}}}`,
+			entries: 1,
+		},
+		{
+			name:   "batch",
+			header: map[string]string{"Content-Type": "application/cloudevents-batch+json"},
+			body: `[{"specversion": "1.0", "type": "com.example.order.created", "source": "/checkout", "id": "1", "subject": "orders", "time": "2023-01-10T12:00:00Z", "data": {"route": "checkout", "order": {"total": 12.5}}},
+				{"specversion": "1.0", "type": "com.example.order.shipped", "source": "/shipping", "id": "2"}]`,
+			entries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inserter := &mykotest.Service{}
+			r, err := New(cfg, inserter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodPost, r.Path(), strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %v, want %v: %s", w.Code, http.StatusAccepted, w.Body)
+			}
+			if len(inserter.Entries()) != tt.entries {
+				t.Fatalf("len(entries) = %v, want %v", len(inserter.Entries()), tt.entries)
+			}
+			e := inserter.Entries()[0]
+			if e.Target != "orders" || e.Origin != "checkout" {
+				t.Errorf("entry = %v/%v, want orders/checkout", e.Target, e.Origin)
+			}
+			if got := e.Timestamp.AsTime().Unix(); got != 1673352000 {
+				t.Errorf("timestamp = %v, want 1673352000", got)
+			}
+			if got := e.Events[1].Value; got != 12.5 {
+				t.Errorf("order_total = %v, want 12.5", got)
+			}
+		})
+	}
+}
+
+func TestReceiver_InsertErrors(t *testing.T) {
+	cfg := config.CloudEventsConfig{
+		Mappings: []config.CloudEventMappingConfig{{
+			Type: "com.example.order.created",
+			EntryMappingConfig: config.EntryMappingConfig{
+				Target: "orders",
+				Events: []config.EventMappingConfig{{Name: "order_count"}},
+			},
+		}},
+	}
+	body := `{"specversion": "1.0", "type": "com.example.order.created", "source": "/checkout", "id": "1"}`
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid", twirp.NewError(twirp.InvalidArgument, "invalid entry"), http.StatusBadRequest},
+		{"unavailable", errors.New("datastore is down"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inserter := &mykotest.Service{}
+			inserter.Fail(tt.err)
+			r, err := New(cfg, inserter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodPost, r.Path(), strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/cloudevents+json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiver_Rejections(t *testing.T) {
+	cfg := config.CloudEventsConfig{
+		Mappings: []config.CloudEventMappingConfig{{
+			Type: "com.example.order.created",
+			EntryMappingConfig: config.EntryMappingConfig{
+				Target: "orders",
+				Events: []config.EventMappingConfig{{Name: "order_total", Field: "data.total"}},
+			},
+		}},
+	}
+	inserter := &mykotest.Service{Reject: func(e *pb.Entry) string {
+		if e.Origin == "/late" {
+			return "entry is too old"
+		}
+		return ""
+	}}
+	r, err := New(cfg, inserter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `[{"specversion": "1.0", "type": "com.example.order.created", "source": "/checkout", "id": "1", "data": {"total": 1}},
+		{"specversion": "1.0", "type": "com.example.order.created", "source": "/checkout", "id": "2", "data": {"total": "twelve"}},
+		{"specversion": "1.0", "type": "com.example.order.created", "source": "/late", "id": "3", "data": {"total": 1}}]`
+	req := httptest.NewRequest(http.MethodPost, r.Path(), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/cloudevents-batch+json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %v, want %v: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	if got := len(inserter.Entries()); got != 1 {
+		t.Errorf("len(entries) = %v, want 1", got)
+	}
+	var resp struct {
+		Rejections []rejection `json:"rejections"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Rejections) != 2 || resp.Rejections[0].Index != 1 || resp.Rejections[1].Index != 2 {
+		t.Errorf("rejections = %v, want events 1 and 2", resp.Rejections)
+	}
+}
@@ -0,0 +1,97 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/format"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Mapper maps the fields of records, such as parsed log lines,
+// rows or events, to entries.
+type Mapper struct {
+	cfg   config.EntryMappingConfig
+	exact map[string]int
+}
+
+// NewMapper returns a mapper. The values of the given exact
+// events are also mapped as decimals unless they are scaled.
+func NewMapper(cfg config.EntryMappingConfig, exact map[string]int) (*Mapper, error) {
+	if cfg.OriginField == "" || (cfg.Target == "" && cfg.TargetField == "") {
+		return nil, errors.New("mappings need an origin field and a target or a target field")
+	}
+	return &Mapper{cfg: cfg, exact: exact}, nil
+}
+
+// Entry maps the fields of a record to an entry. The entry has
+// no timestamp if the time field is not set in the record.
+func (m *Mapper) Entry(fields map[string]string) (*pb.Entry, error) {
+	target := m.cfg.Target
+	if target == "" {
+		target = fields[m.cfg.TargetField]
+	}
+	origin := fields[m.cfg.OriginField]
+	if target == "" || origin == "" {
+		return nil, errors.New("record doesn't contain a target or an origin")
+	}
+	entry := &pb.Entry{
+		Target: format.Name(target),
+		Origin: format.Name(origin),
+	}
+	if v := fields[m.cfg.TimeField]; m.cfg.TimeField != "" && v != "" {
+		ts, err := parseTime(m.cfg.TimeLayout, v)
+		if err != nil {
+			return nil, err
+		}
+		entry.Timestamp = timestamppb.New(ts)
+	}
+
+	for _, ec := range m.cfg.Events {
+		ev := &pb.Event{Name: ec.Name, Value: 1}
+		if ec.Unit != "" {
+			ev.Name += "_" + ec.Unit
+		}
+		if ec.Field != "" {
+			s := fields[ec.Field]
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed value of %q: %w", ec.Field, err)
+			}
+			ev.Value = v
+			if _, exact := m.exact[ev.Name]; exact && ec.Scale == 0 {
+				ev.Decimal = s
+			}
+		}
+		if ec.Scale != 0 {
+			ev.Value *= ec.Scale
+		}
+		entry.Events = append(entry.Events, ev)
+	}
+	return entry, nil
+}
+
+func parseTime(layout, v string) (time.Time, error) {
+	switch layout {
+	case "unix":
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("malformed time %q", v)
+		}
+		return time.Unix(0, int64(secs*float64(time.Second))), nil
+	case "unix_ms":
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("malformed time %q", v)
+		}
+		return time.UnixMilli(ms), nil
+	case "":
+		layout = time.RFC3339
+	}
+	return time.Parse(layout, v)
+}
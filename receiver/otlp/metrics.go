@@ -0,0 +1,120 @@
+package otlp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/format"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// metricEntries converts the data points of the configured
+// metrics into entries. Data points of other metrics and
+// unsupported metric types are ignored.
+func (r *Receiver) metricEntries(req *colmetricspb.ExportMetricsServiceRequest) []*pb.Entry {
+	var entries []*pb.Entry
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				for _, mc := range r.cfg.Metrics {
+					if mc.Metric != m.Name {
+						continue
+					}
+					entries = append(entries, metricEntries(mc, rm.Resource, m)...)
+				}
+			}
+		}
+	}
+	return entries
+}
+
+func metricEntries(mc config.OTLPMetricConfig, res *resourcepb.Resource, m *metricspb.Metric) []*pb.Entry {
+	event := mc.Event
+	if event == "" {
+		event = strings.ReplaceAll(m.Name, ".", "_")
+	}
+
+	var entries []*pb.Entry
+	newEntry := func(attrs []*commonpb.KeyValue, ts uint64, events ...*pb.Event) {
+		origin := attribute(attrs, mc.OriginAttribute)
+		if origin == "" {
+			return
+		}
+		target := serviceName(res)
+		if mc.TargetAttribute != "" {
+			target = attribute(attrs, mc.TargetAttribute)
+		}
+		if target == "" {
+			return
+		}
+		entries = append(entries, &pb.Entry{
+			Target:    format.Name(target),
+			Origin:    format.Name(origin),
+			Source:    source(res, m.Name, attrs),
+			Timestamp: timestamppb.New(time.Unix(0, int64(ts))),
+			Events:    events,
+		})
+	}
+
+	switch data := m.Data.(type) {
+	case *metricspb.Metric_Sum:
+		if !data.Sum.IsMonotonic {
+			return nil // not summable
+		}
+		kind := temporalityKind(data.Sum.AggregationTemporality)
+		for _, dp := range data.Sum.DataPoints {
+			value := dp.GetAsDouble()
+			if _, ok := dp.Value.(*metricspb.NumberDataPoint_AsInt); ok {
+				value = float64(dp.GetAsInt())
+			}
+			newEntry(dp.Attributes, dp.TimeUnixNano, &pb.Event{Name: event, Kind: kind, Value: value})
+		}
+	case *metricspb.Metric_Histogram:
+		kind := temporalityKind(data.Histogram.AggregationTemporality)
+		for _, dp := range data.Histogram.DataPoints {
+			newEntry(dp.Attributes, dp.TimeUnixNano,
+				&pb.Event{Name: event, Kind: kind, Value: dp.GetSum()},
+				&pb.Event{Name: event + "_count", Kind: kind, Value: float64(dp.Count)},
+			)
+		}
+	}
+	return entries
+}
+
+func temporalityKind(t metricspb.AggregationTemporality) pb.Kind {
+	if t == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		return pb.Kind_CUMULATIVE
+	}
+	return pb.Kind_SUM
+}
+
+// source identifies the time series of a data point, so cumulative
+// values of different series are converted into deltas separately.
+func source(res *resourcepb.Resource, metric string, attrs []*commonpb.KeyValue) string {
+	var kvs []string
+	for _, kv := range res.GetAttributes() {
+		kvs = append(kvs, kv.Key+"="+valueString(kv.Value))
+	}
+	for _, kv := range attrs {
+		kvs = append(kvs, kv.Key+"="+valueString(kv.Value))
+	}
+	sort.Strings(kvs)
+
+	h := fnv.New64a()
+	h.Write([]byte(metric))
+	for _, kv := range kvs {
+		h.Write([]byte{0})
+		h.Write([]byte(kv))
+	}
+	return fmt.Sprintf("otlp-%x", h.Sum64())
+}
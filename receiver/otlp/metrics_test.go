@@ -0,0 +1,93 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/mykodev/myko/config"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestMetricEntries(t *testing.T) {
+	attrs := []*commonpb.KeyValue{stringAttr("origin", "site_navbar"), stringAttr("db", "mysql")}
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "webserver")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Metrics: []*metricspb.Metric{
+					{
+						Name: "db.queries",
+						Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+							IsMonotonic:            true,
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*metricspb.NumberDataPoint{
+								{Attributes: attrs, TimeUnixNano: 1e9, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 5}},
+								// Data points without an origin are ignored.
+								{TimeUnixNano: 1e9, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}},
+							},
+						}},
+					},
+					{
+						Name: "db.latency",
+						Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+							DataPoints: []*metricspb.HistogramDataPoint{
+								{Attributes: attrs, TimeUnixNano: 1e9, Count: 4, Sum: floatPtr(20)},
+							},
+						}},
+					},
+					{
+						Name: "db.connections",
+						Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+							DataPoints: []*metricspb.NumberDataPoint{
+								{Attributes: attrs, TimeUnixNano: 1e9, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}},
+							},
+						}},
+					},
+					{Name: "unconfigured"},
+				},
+			}},
+		}},
+	}
+
+	r := New(config.OTLPConfig{Metrics: []config.OTLPMetricConfig{
+		{Metric: "db.queries", OriginAttribute: "origin", TargetAttribute: "db"},
+		{Metric: "db.latency", Event: "query_latency_ms", OriginAttribute: "origin"},
+		{Metric: "db.connections", OriginAttribute: "origin"},
+	}}, nil)
+	entries := r.metricEntries(req)
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %v, want 2", len(entries))
+	}
+
+	e := entries[0]
+	if e.Target != "mysql" || e.Origin != "site_navbar" || e.Timestamp.AsTime().Unix() != 1 || e.Source == "" {
+		t.Errorf("entry = %v", e)
+	}
+	if len(e.Events) != 1 || e.Events[0].Name != "db_queries" || e.Events[0].Kind != pb.Kind_CUMULATIVE || e.Events[0].Value != 5 {
+		t.Errorf("events = %v, want a cumulative db_queries of 5", e.Events)
+	}
+
+	e = entries[1]
+	if e.Target != "webserver" || e.Origin != "site_navbar" || e.Source == entries[0].Source {
+		t.Errorf("entry = %v", e)
+	}
+	want := []*pb.Event{
+		{Name: "query_latency_ms", Kind: pb.Kind_SUM, Value: 20},
+		{Name: "query_latency_ms_count", Kind: pb.Kind_SUM, Value: 4},
+	}
+	if len(e.Events) != len(want) {
+		t.Fatalf("events = %v, want %v", e.Events, want)
+	}
+	for i, ev := range e.Events {
+		if ev.Name != want[i].Name || ev.Kind != want[i].Kind || ev.Value != want[i].Value {
+			t.Errorf("event = %v, want %v", ev, want[i])
+		}
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
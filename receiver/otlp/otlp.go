@@ -0,0 +1,192 @@
+// Package otlp receives OpenTelemetry traces and metrics
+// over OTLP and converts them into entries.
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/receiver"
+	"github.com/mykodev/myko/traces"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// maxBodySize is the maximum size of uncompressed HTTP
+// requests, the default maximum message size of gRPC.
+const maxBodySize = 4 << 20
+
+type Receiver struct {
+	cfg        config.OTLPConfig
+	attributor *traces.Attributor
+	inserter   receiver.Inserter
+}
+
+func New(cfg config.OTLPConfig, inserter receiver.Inserter) *Receiver {
+	return &Receiver{
+		cfg: cfg,
+		// The server aggregates the entries into its windows.
+		attributor: traces.NewAttributor(cfg.Traces, 0),
+		inserter:   inserter,
+	}
+}
+
+// Handler returns the OTLP/HTTP handler serving /v1/traces
+// and /v1/metrics. Only the binary protobuf encoding is supported.
+func (r *Receiver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/traces", func(w http.ResponseWriter, req *http.Request) {
+		var tr coltracepb.ExportTraceServiceRequest
+		serveHTTP(w, req, &tr, &coltracepb.ExportTraceServiceResponse{}, func(ctx context.Context) error {
+			entries, err := r.traceEntries(&tr)
+			if err != nil {
+				return err
+			}
+			return r.insert(ctx, entries)
+		})
+	})
+	mux.HandleFunc("/v1/metrics", func(w http.ResponseWriter, req *http.Request) {
+		var mr colmetricspb.ExportMetricsServiceRequest
+		serveHTTP(w, req, &mr, &colmetricspb.ExportMetricsServiceResponse{}, func(ctx context.Context) error {
+			return r.insert(ctx, r.metricEntries(&mr))
+		})
+	})
+	return mux
+}
+
+// RegisterGRPC registers the OTLP/gRPC trace and metrics services.
+func (r *Receiver) RegisterGRPC(s *grpc.Server) {
+	coltracepb.RegisterTraceServiceServer(s, &traceService{r: r})
+	colmetricspb.RegisterMetricsServiceServer(s, &metricsService{r: r})
+}
+
+func (r *Receiver) insert(ctx context.Context, entries []*pb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	// Spans and points outside of the tolerance are rejected
+	// without failing the rest of the request, exporters
+	// don't retry invalid requests.
+	resp, err := r.inserter.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries, Partial: true})
+	if err != nil {
+		return err
+	}
+	if len(resp.Rejections) > 0 {
+		log.Printf("Rejected %d entries received over OTLP: %v", len(resp.Rejections), resp.Rejections[0].Reason)
+	}
+	return nil
+}
+
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	r *Receiver
+}
+
+func (s *traceService) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	entries, err := s.r.traceEntries(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.r.insert(ctx, entries); err != nil {
+		return nil, err
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	r *Receiver
+}
+
+func (s *metricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	if err := s.r.insert(ctx, s.r.metricEntries(req)); err != nil {
+		return nil, err
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func serveHTTP(w http.ResponseWriter, req *http.Request, msg, resp proto.Message, export func(ctx context.Context) error) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := req.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/x-protobuf") {
+		http.Error(w, "unsupported content type, use application/x-protobuf", http.StatusUnsupportedMediaType)
+		return
+	}
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gr.Close()
+		body = gr
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := proto.Unmarshal(b, msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := export(req.Context()); err != nil {
+		http.Error(w, err.Error(), receiver.StatusCode(err))
+		return
+	}
+	b, err = proto.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(b)
+}
+
+// attribute returns the string form of the attribute with the
+// given key, or an empty string if the attribute isn't set.
+func attribute(attrs []*commonpb.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return valueString(kv.Value)
+		}
+	}
+	return ""
+}
+
+// valueString returns the string form of scalar values.
+func valueString(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	}
+	return ""
+}
+
+func serviceName(res *resourcepb.Resource) string {
+	if name := attribute(res.GetAttributes(), "service.name"); name != "" {
+		return name
+	}
+	return "unknown_service"
+}
@@ -0,0 +1,79 @@
+package otlp
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/mykotest"
+	"github.com/twitchtv/twirp"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandler(t *testing.T) {
+	req := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "webserver")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{
+					TraceId:    []byte("trace-1"),
+					SpanId:     []byte("root"),
+					Name:       "GET /nav",
+					Kind:       tracepb.Span_SPAN_KIND_CLIENT,
+					Attributes: []*commonpb.KeyValue{stringAttr("db.system", "mysql")},
+				}},
+			}},
+		}},
+	}
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		err         error
+		want        int
+	}{
+		{"ok", "application/x-protobuf", nil, http.StatusOK},
+		{"json", "application/json", nil, http.StatusUnsupportedMediaType},
+		{"invalid", "application/x-protobuf", twirp.NewError(twirp.InvalidArgument, "invalid entry"), http.StatusBadRequest},
+		{"unavailable", "application/x-protobuf", errors.New("datastore is down"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &mykotest.Service{}
+			service.Fail(tt.err)
+			h := New(config.OTLPConfig{}, service).Handler()
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if reqs := service.Requests(); len(reqs) != 1 || !reqs[0].Partial {
+				t.Errorf("requests = %v, want a partial insert", reqs)
+			}
+			entries := service.Entries()
+			if len(entries) != 1 || entries[0].Target != "mysql" || entries[0].Origin != "GET /nav" {
+				t.Errorf("entries = %v, want a mysql call of GET /nav", entries)
+			}
+			if err := proto.Unmarshal(w.Body.Bytes(), &coltracepb.ExportTraceServiceResponse{}); err != nil {
+				t.Errorf("response = %v", err)
+			}
+		})
+	}
+}
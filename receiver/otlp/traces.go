@@ -0,0 +1,50 @@
+package otlp
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mykodev/myko/traces"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// traceEntries attributes client spans to the origin of their
+// root span as the trace importer does. Spans of the same trace
+// exported in different requests can't be connected.
+func (r *Receiver) traceEntries(req *coltracepb.ExportTraceServiceRequest) ([]*pb.Entry, error) {
+	var spans []*traces.Span
+	for _, rs := range req.ResourceSpans {
+		service := serviceName(rs.Resource)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				var duration time.Duration
+				if s.EndTimeUnixNano > s.StartTimeUnixNano {
+					duration = time.Duration(s.EndTimeUnixNano - s.StartTimeUnixNano)
+				}
+				spans = append(spans, &traces.Span{
+					TraceID:  string(s.TraceId),
+					ID:       string(s.SpanId),
+					ParentID: string(s.ParentSpanId),
+					Name:     s.Name,
+					Service:  service,
+					Kind:     strings.ToLower(strings.TrimPrefix(s.Kind.String(), "SPAN_KIND_")),
+					Start:    time.Unix(0, int64(s.StartTimeUnixNano)),
+					Duration: duration,
+					Tags:     tags(s.Attributes),
+				})
+			}
+		}
+	}
+	return r.attributor.Entries(spans)
+}
+
+func tags(attrs []*commonpb.KeyValue) map[string]string {
+	tags := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		tags[kv.Key] = valueString(kv.Value)
+	}
+	return tags
+}
@@ -0,0 +1,108 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/mykodev/myko/config"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestTraceEntries(t *testing.T) {
+	traceID := []byte("trace-1")
+	req := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "webserver")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{
+					{
+						TraceId:    traceID,
+						SpanId:     []byte("root"),
+						Name:       "GET /nav",
+						Kind:       tracepb.Span_SPAN_KIND_SERVER,
+						Attributes: []*commonpb.KeyValue{stringAttr("http.route", "site_navbar")},
+					},
+					{
+						TraceId:      traceID,
+						SpanId:       []byte("render"),
+						ParentSpanId: []byte("root"),
+						Kind:         tracepb.Span_SPAN_KIND_INTERNAL,
+					},
+					{
+						TraceId:           traceID,
+						SpanId:            []byte("query"),
+						ParentSpanId:      []byte("render"),
+						Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+						StartTimeUnixNano: 1e9,
+						EndTimeUnixNano:   1e9 + 12.5e6,
+						Attributes:        []*commonpb.KeyValue{stringAttr("db.system", "mysql")},
+					},
+					{
+						TraceId:      traceID,
+						SpanId:       []byte("untargeted"),
+						ParentSpanId: []byte("root"),
+						Kind:         tracepb.Span_SPAN_KIND_CLIENT,
+					},
+				},
+			}},
+		}},
+	}
+
+	r := New(config.OTLPConfig{Traces: config.OTLPTracesConfig{OriginService: true}}, nil)
+	entries, err := r.traceEntries(req)
+	if err != nil {
+		t.Fatalf("traceEntries() = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("len(entries) = %v, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Target != "mysql" || e.Origin != "webserver/site_navbar" {
+		t.Errorf("entry = %v/%v, want mysql/webserver/site_navbar", e.Target, e.Origin)
+	}
+	if got := eventValues(e); len(got) != 2 || got["span_count"] != 1 || got["span_duration_ms"] != 12.5 {
+		t.Errorf("events = %v, want a count of 1 and a duration of 12.5ms", e.Events)
+	}
+}
+
+func TestTraceEntries_EndBeforeStart(t *testing.T) {
+	req := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{
+					TraceId:           []byte("trace-1"),
+					SpanId:            []byte("root"),
+					Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+					StartTimeUnixNano: 2e9,
+					EndTimeUnixNano:   1e9,
+					Attributes:        []*commonpb.KeyValue{stringAttr("db.system", "mysql")},
+				}},
+			}},
+		}},
+	}
+	entries, err := New(config.OTLPConfig{}, nil).traceEntries(req)
+	if err != nil {
+		t.Fatalf("traceEntries() = %v", err)
+	}
+	if len(entries) != 1 || eventValues(entries[0])["span_duration_ms"] != 0 {
+		t.Errorf("entries = %v, want a duration of 0ms", entries)
+	}
+}
+
+// eventValues returns the values of the events of e by name,
+// the events of entries are not ordered.
+func eventValues(e *pb.Entry) map[string]float64 {
+	values := make(map[string]float64, len(e.Events))
+	for _, ev := range e.Events {
+		values[ev.Name] = ev.Value
+	}
+	return values
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
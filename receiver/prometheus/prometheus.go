@@ -0,0 +1,150 @@
+// Package prometheus receives Prometheus remote-write
+// requests and converts the samples into entries.
+package prometheus
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/format"
+	"github.com/mykodev/myko/receiver"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// maxBodySize is the maximum size of requests, compressed
+// and decompressed.
+const maxBodySize = 4 << 20
+
+type Receiver struct {
+	cfg      config.PrometheusConfig
+	metrics  map[string]config.PrometheusMetricConfig
+	inserter receiver.Inserter
+}
+
+func New(cfg config.PrometheusConfig, inserter receiver.Inserter) *Receiver {
+	if cfg.Path == "" {
+		cfg.Path = "/api/v1/write"
+	}
+	metrics := make(map[string]config.PrometheusMetricConfig, len(cfg.Metrics))
+	for _, mc := range cfg.Metrics {
+		metrics[mc.Metric] = mc
+	}
+	return &Receiver{cfg: cfg, metrics: metrics, inserter: inserter}
+}
+
+// Path returns the HTTP path the receiver needs to be served at.
+func (r *Receiver) Path() string {
+	return r.cfg.Path
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	compressed, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if n, err := snappy.DecodedLen(compressed); err != nil || n > maxBodySize {
+		http.Error(w, "malformed or too large snappy block", http.StatusBadRequest)
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := parseWriteRequest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries := r.entries(series)
+	if len(entries) > 0 {
+		// Samples outside of the tolerance are rejected
+		// without failing the rest of the request.
+		resp, err := r.inserter.InsertEvents(req.Context(), &pb.InsertEventsRequest{Entries: entries, Partial: true})
+		if err != nil {
+			// Prometheus retries 5xx responses but drops 4xx
+			// responses. Invalid entries won't succeed on retry.
+			http.Error(w, err.Error(), receiver.StatusCode(err))
+			return
+		}
+		if len(resp.Rejections) > 0 {
+			log.Printf("Rejected %d samples received over remote write: %v", len(resp.Rejections), resp.Rejections[0].Reason)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// entries converts the samples of the configured metrics
+// into entries. Counter samples are cumulative and the server
+// converts them into deltas per time series.
+func (r *Receiver) entries(series []timeSeries) []*pb.Entry {
+	var entries []*pb.Entry
+	for _, ts := range series {
+		mc, ok := r.metrics[ts.labels["__name__"]]
+		if !ok {
+			continue
+		}
+		origin, target := ts.labels[mc.OriginLabel], ts.labels[mc.TargetLabel]
+		if origin == "" || target == "" {
+			continue
+		}
+		event := mc.Event
+		if event == "" {
+			event = mc.Metric
+		}
+		kind := pb.Kind_CUMULATIVE
+		if mc.Gauge {
+			kind = pb.Kind_SUM
+		}
+		source := seriesID(ts.labels)
+		for _, s := range ts.samples {
+			if math.IsNaN(s.value) {
+				continue // staleness markers
+			}
+			entries = append(entries, &pb.Entry{
+				Target:    format.Name(target),
+				Origin:    format.Name(origin),
+				Source:    source,
+				Timestamp: timestamppb.New(time.UnixMilli(s.timestamp)),
+				Events: []*pb.Event{
+					{Name: format.Name(event), Kind: kind, Value: s.value},
+				},
+			})
+		}
+	}
+	return entries
+}
+
+// seriesID identifies a time series by its labels, so each
+// series of a counter is converted into deltas separately.
+func seriesID(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := fnv.New64a()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(labels[name]))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("prometheus-%x", h.Sum64())
+}
@@ -0,0 +1,142 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/mykotest"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestEntries(t *testing.T) {
+	b := appendTimeSeries(nil, map[string]string{
+		"__name__": "http_requests_total",
+		"route":    "site_navbar",
+		"upstream": "webserver-mysql",
+		"instance": "host1:9090",
+	}, 10, 15, math.NaN())
+	b = appendTimeSeries(b, map[string]string{
+		"__name__": "unmapped_total",
+		"route":    "site_navbar",
+		"upstream": "webserver-mysql",
+	}, 1)
+
+	series, err := parseWriteRequest(b)
+	if err != nil {
+		t.Fatalf("parseWriteRequest() = %v", err)
+	}
+	r := New(config.PrometheusConfig{
+		Metrics: []config.PrometheusMetricConfig{{
+			Metric:      "http_requests_total",
+			Event:       "request_count",
+			OriginLabel: "route",
+			TargetLabel: "upstream",
+		}},
+	}, nil)
+	entries := r.entries(series)
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %v, want 2", len(entries))
+	}
+	for i, want := range []float64{10, 15} {
+		e := entries[i]
+		if e.Target != "webserver-mysql" || e.Origin != "site_navbar" || e.Source == "" {
+			t.Errorf("entries[%d] = %v, want a webserver-mysql/site_navbar entry with a source", i, e)
+		}
+		ev := e.Events[0]
+		if ev.Name != "request_count" || ev.Kind != pb.Kind_CUMULATIVE || ev.Value != want {
+			t.Errorf("entries[%d].Events[0] = %v, want a cumulative request_count of %v", i, ev, want)
+		}
+		if e.Timestamp.AsTime().UnixMilli() != int64(1000*(i+1)) {
+			t.Errorf("entries[%d].Timestamp = %v", i, e.Timestamp.AsTime())
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	body := snappy.Encode(nil, appendTimeSeries(nil, map[string]string{
+		"__name__": "http_requests_total",
+		"route":    "site_navbar",
+		"upstream": "webserver-mysql",
+	}, 10))
+	cfg := config.PrometheusConfig{
+		Metrics: []config.PrometheusMetricConfig{{
+			Metric:      "http_requests_total",
+			OriginLabel: "route",
+			TargetLabel: "upstream",
+		}},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"ok", nil, http.StatusNoContent},
+		{"invalid", twirp.NewError(twirp.InvalidArgument, "invalid entry"), http.StatusBadRequest},
+		{"unavailable", errors.New("datastore is down"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &mykotest.Service{}
+			service.Fail(tt.err)
+			w := httptest.NewRecorder()
+			New(cfg, service).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.err != nil {
+				return
+			}
+			reqs := service.Requests()
+			if len(reqs) != 1 || !reqs[0].Partial || len(reqs[0].Entries) != 1 {
+				t.Errorf("requests = %v, want a partial request with the sample", reqs)
+			}
+		})
+	}
+}
+
+func TestServeHTTP_TooLarge(t *testing.T) {
+	// A snappy block only made of the header claiming
+	// its decompressed length.
+	body := binary.AppendUvarint(nil, maxBodySize+1)
+	service := &mykotest.Service{}
+	w := httptest.NewRecorder()
+	New(config.PrometheusConfig{}, service).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func appendTimeSeries(b []byte, labels map[string]string, values ...float64) []byte {
+	var ts []byte
+	for name, value := range labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, value)
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, label)
+	}
+	for i, v := range values {
+		var s []byte
+		s = protowire.AppendTag(s, 1, protowire.Fixed64Type)
+		s = protowire.AppendFixed64(s, math.Float64bits(v))
+		s = protowire.AppendTag(s, 2, protowire.VarintType)
+		s = protowire.AppendVarint(s, uint64(1000*(i+1)))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, s)
+	}
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
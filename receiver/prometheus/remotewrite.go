@@ -0,0 +1,88 @@
+package prometheus
+
+import (
+	"math"
+
+	"github.com/mykodev/myko/internal/wire"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The remote-write protocol sends a snappy compressed protobuf
+// WriteRequest. Only the fields needed to convert samples into
+// entries are decoded:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+
+type timeSeries struct {
+	labels  map[string]string
+	samples []sample
+}
+
+type sample struct {
+	value     float64
+	timestamp int64 // in milliseconds
+}
+
+func parseWriteRequest(b []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	err := wire.ParseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := parseTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func parseTimeSeries(b []byte) (timeSeries, error) {
+	ts := timeSeries{labels: make(map[string]string)}
+	err := wire.ParseMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			var name, value string
+			err := wire.ParseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					name = string(v)
+				case num == 2 && typ == protowire.BytesType:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.labels[name] = value
+		case 2:
+			var s sample
+			err := wire.ParseMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					bits, _ := protowire.ConsumeFixed64(v)
+					s.value = math.Float64frombits(bits)
+				case num == 2 && typ == protowire.VarintType:
+					millis, _ := protowire.ConsumeVarint(v)
+					s.timestamp = int64(millis)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.samples = append(ts.samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
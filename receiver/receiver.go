@@ -0,0 +1,31 @@
+// Package receiver contains the building blocks shared by the
+// receivers that convert other telemetry formats into entries.
+package receiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/twitchtv/twirp"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Inserter inserts entries. It's implemented by the server, so
+// the converted entries are verified and batched like the ones
+// sent to the InsertEvents RPC.
+type Inserter interface {
+	InsertEvents(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error)
+}
+
+// StatusCode returns the HTTP status code of an insert error.
+// Invalid entries are client errors, other errors are server
+// errors, so the senders retry.
+func StatusCode(err error) int {
+	var twerr twirp.Error
+	if errors.As(err, &twerr) && twerr.Code() == twirp.InvalidArgument {
+		return http.StatusBadRequest
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,59 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// parseLine parses a line in the following format:
+//
+//	<target>;<origin>;<event>:<value>[|<unit>][|@<sample_rate>]
+//
+// For example:
+//
+//	webserver-mysql;site_navbar;sql_query_latency:40.5|ms|@0.1
+//
+// The unit is appended to the event name, so the example above
+// is an sql_query_latency_ms event.
+func parseLine(line string) (*pb.Entry, error) {
+	fields := strings.Split(line, ";")
+	if len(fields) != 3 {
+		return nil, errors.New("line should have a target, an origin and an event separated by semicolons")
+	}
+	target, origin := fields[0], fields[1]
+
+	parts := strings.Split(fields[2], "|")
+	name, v, ok := strings.Cut(parts[0], ":")
+	if !ok || name == "" {
+		return nil, errors.New("event should be formatted as name:value")
+	}
+	value, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed event value %q", v)
+	}
+
+	ev := &pb.Event{Name: name, Value: value}
+	for i, part := range parts[1:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("malformed sample rate %q", part)
+			}
+			ev.SampleRate = rate
+		case i == 0 && part != "":
+			ev.Name += "_" + part
+		default:
+			return nil, fmt.Errorf("unexpected field %q", part)
+		}
+	}
+	return &pb.Entry{
+		Target: target,
+		Origin: origin,
+		Events: []*pb.Event{ev},
+	}, nil
+}
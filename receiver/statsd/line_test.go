@@ -0,0 +1,57 @@
+package statsd
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    *pb.Entry
+		wantErr bool
+	}{
+		{
+			line: "webserver;site_navbar;render_ms:23.1",
+			want: &pb.Entry{
+				Target: "webserver",
+				Origin: "site_navbar",
+				Events: []*pb.Event{{Name: "render_ms", Value: 23.1}},
+			},
+		},
+		{
+			line: "webserver-mysql;site_navbar;sql_query_latency:40.5|ms|@0.1",
+			want: &pb.Entry{
+				Target: "webserver-mysql",
+				Origin: "site_navbar",
+				Events: []*pb.Event{{Name: "sql_query_latency_ms", Value: 40.5, SampleRate: 0.1}},
+			},
+		},
+		{
+			line: "webserver-mysql;site_navbar;sql_query_count:1|@0.5",
+			want: &pb.Entry{
+				Target: "webserver-mysql",
+				Origin: "site_navbar",
+				Events: []*pb.Event{{Name: "sql_query_count", Value: 1, SampleRate: 0.5}},
+			},
+		},
+		{line: "site_navbar;render_ms:23.1", wantErr: true},
+		{line: "webserver;site_navbar;render_ms", wantErr: true},
+		{line: "webserver;site_navbar;render_ms:abc", wantErr: true},
+		{line: "webserver;site_navbar;render_ms:1|@2", wantErr: true},
+		{line: "webserver;site_navbar;render_ms:1|ms|s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !proto.Equal(got, tt.want) {
+			t.Errorf("parseLine(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
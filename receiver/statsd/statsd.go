@@ -0,0 +1,170 @@
+// Package statsd receives events as text lines over UDP
+// or Unix datagram sockets. See parseLine for the format.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/receiver"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// maxBatchSize is the number of entries
+// inserted at once at most.
+const maxBatchSize = 1024
+
+type Receiver struct {
+	cfg      config.StatsDConfig
+	inserter receiver.Inserter
+
+	lines        atomic.Uint64
+	parseErrors  atomic.Uint64
+	insertErrors atomic.Uint64
+}
+
+func New(cfg config.StatsDConfig, inserter receiver.Inserter) *Receiver {
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = time.Second
+	}
+	return &Receiver{cfg: cfg, inserter: inserter}
+}
+
+// Lines returns the number of lines received.
+func (r *Receiver) Lines() uint64 {
+	return r.lines.Load()
+}
+
+// ParseErrors returns the number of lines that couldn't be parsed.
+func (r *Receiver) ParseErrors() uint64 {
+	return r.parseErrors.Load()
+}
+
+// InsertErrors returns the number of entries that couldn't be inserted.
+func (r *Receiver) InsertErrors() uint64 {
+	return r.insertErrors.Load()
+}
+
+// Serve listens at the configured addresses and inserts the
+// received lines in batches until ctx is done. The remaining
+// lines are inserted before Serve returns.
+func (r *Receiver) Serve(ctx context.Context) error {
+	var conns []net.PacketConn
+	if r.cfg.Listen != "" {
+		conn, err := net.ListenPacket("udp", r.cfg.Listen)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+	}
+	if r.cfg.Socket != "" {
+		// Remove the socket file left behind by a previous run.
+		if err := os.Remove(r.cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		conn, err := net.ListenPacket("unixgram", r.cfg.Socket)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+	}
+	return r.serve(ctx, conns)
+}
+
+func (r *Receiver) serve(ctx context.Context, conns []net.PacketConn) error {
+	entries := make(chan *pb.Entry, maxBatchSize)
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn net.PacketConn) {
+			defer wg.Done()
+			r.read(conn, entries)
+		}(conn)
+	}
+	go func() {
+		<-ctx.Done()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		wg.Wait()
+		close(entries)
+	}()
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var reportedErrors uint64
+	batch := make([]*pb.Entry, 0, maxBatchSize)
+	for {
+		select {
+		case e, ok := <-entries:
+			if !ok {
+				r.insert(batch)
+				return nil
+			}
+			batch = append(batch, e)
+			if len(batch) < maxBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if n := r.ParseErrors(); n > reportedErrors {
+				log.Printf("Failed to parse %d lines received over datagrams", n-reportedErrors)
+				reportedErrors = n
+			}
+		}
+		r.insert(batch)
+		batch = batch[:0]
+	}
+}
+
+func (r *Receiver) read(conn net.PacketConn, entries chan<- *pb.Entry) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Failed to read from %v: %v", conn.LocalAddr(), err)
+			}
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			r.lines.Add(1)
+			e, err := parseLine(line)
+			if err != nil {
+				r.parseErrors.Add(1)
+				continue
+			}
+			entries <- e
+		}
+	}
+}
+
+func (r *Receiver) insert(batch []*pb.Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	// Insert partially, so an invalid line doesn't
+	// drop the other lines of the batch.
+	resp, err := r.inserter.InsertEvents(context.Background(), &pb.InsertEventsRequest{Entries: batch, Partial: true})
+	if err != nil {
+		r.insertErrors.Add(uint64(len(batch)))
+		log.Printf("Failed to insert %d entries received over datagrams: %v", len(batch), err)
+		return
+	}
+	if len(resp.Rejections) > 0 {
+		r.insertErrors.Add(uint64(len(resp.Rejections)))
+		log.Printf("Rejected %d entries received over datagrams: %v", len(resp.Rejections), resp.Rejections[0].Reason)
+	}
+}
@@ -0,0 +1,82 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/mykotest"
+)
+
+func TestServe(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	service := &mykotest.Service{}
+	r := New(config.StatsDConfig{FlushInterval: time.Hour}, service)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- r.serve(ctx, []net.PacketConn{conn})
+	}()
+
+	// A full batch is inserted without waiting for the flush interval.
+	for i := 0; i < maxBatchSize; i += 64 {
+		var lines []string
+		for j := i; j < i+64; j++ {
+			lines = append(lines, fmt.Sprintf("webserver;origin_%d;render_ms:1", j))
+		}
+		if _, err := client.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return len(service.Requests()) == 1 })
+
+	// Malformed lines are counted and skipped, the remaining
+	// lines are inserted when the receiver stops.
+	if _, err := client.Write([]byte("webserver;site_navbar;render_ms:2\nmalformed\n\nwebserver;site_navbar;render_ms:x")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return r.Lines() == maxBatchSize+3 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Serve() = %v", err)
+	}
+
+	reqs := service.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("len(reqs) = %v, want 2", len(reqs))
+	}
+	if len(reqs[0].Entries) != maxBatchSize || !reqs[0].Partial {
+		t.Errorf("first batch has %d entries, want a partial batch of %d", len(reqs[0].Entries), maxBatchSize)
+	}
+	if len(reqs[1].Entries) != 1 || reqs[1].Entries[0].Events[0].Value != 2 {
+		t.Errorf("last batch = %v, want the valid line", reqs[1].Entries)
+	}
+	if r.ParseErrors() != 2 {
+		t.Errorf("ParseErrors() = %v, want 2", r.ParseErrors())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
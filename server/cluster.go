@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/twitchtv/twirp"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// watchCluster watches the cluster membership until ctx is done.
+//
+// When the members change, all windows are written, including
+// the open ones. The keys moved to other members are aggregated
+// by their new owners from then on, and the windows of the keys
+// are written by both members rather than being lost. Cumulative
+// counters moved to another member restart from their next report.
+func (s *Server) watchCluster(ctx context.Context) {
+	s.cluster.Watch(ctx, func() {
+		b := s.batchWriter
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if err := b.flush(time.Now(), true); err != nil {
+			log.Printf("Failed to write the windows after the cluster members changed: %v", err)
+		}
+	})
+}
+
+// insertClustered groups the entries by the members owning
+// their keys, forwards them to their owners and aggregates the
+// owned ones once the others are forwarded. indexes are the
+// indexes of the entries in req. Entries are never aggregated
+// by a member not owning them, if a group fails to be forwarded,
+// an Unavailable error is returned and the owned entries are not
+// aggregated. Each group is deduplicated with the idempotency key
+// of its owner, so the groups forwarded before a failure are not
+// aggregated again when the request is retried.
+//
+// It returns the entries rejected by their owners, or
+// errDuplicate if all groups are duplicates.
+func (s *Server) insertClustered(ctx context.Context, req *pb.InsertEventsRequest, entries []*pb.Entry, indexes []uint32, now time.Time) ([]*pb.Rejection, error) {
+	type group struct {
+		entries []*pb.Entry
+		indexes []uint32
+	}
+	var owners []string
+	groups := make(map[string]*group)
+	for i, entry := range entries {
+		owner := s.cluster.Owner(entry.Target + ":" + entry.Origin)
+		g, ok := groups[owner]
+		if !ok {
+			g = &group{}
+			groups[owner] = g
+			owners = append(owners, owner)
+		}
+		g.entries = append(g.entries, entry)
+		g.indexes = append(g.indexes, indexes[i])
+	}
+
+	var rejections []*pb.Rejection
+	var duplicates int
+	self := s.cluster.Self()
+	for _, owner := range owners {
+		if owner == self {
+			continue
+		}
+		g := groups[owner]
+		resp, err := s.cluster.Client(owner).InsertEvents(ctx, &pb.InsertEventsRequest{
+			Entries:        g.entries,
+			Partial:        req.Partial,
+			IdempotencyKey: memberKey(req.IdempotencyKey, owner),
+			Forwarded:      true,
+			PreAggregated:  req.PreAggregated,
+		})
+		var twerr twirp.Error
+		if errors.As(err, &twerr) && twerr.Code() == twirp.InvalidArgument {
+			return nil, err // rejected by the owner
+		}
+		if err != nil {
+			return nil, twirp.NewError(twirp.Unavailable, fmt.Sprintf("failed to forward %d entries to %q: %v", len(g.entries), owner, err))
+		}
+		if resp.Duplicate {
+			duplicates++
+			continue
+		}
+		for _, r := range resp.Rejections {
+			if int(r.Index) >= len(g.indexes) {
+				continue
+			}
+			rejections = append(rejections, &pb.Rejection{Index: g.indexes[r.Index], Reason: r.Reason})
+		}
+	}
+	if g, ok := groups[self]; ok {
+		err := s.batchWriter.Write(g.entries, now, memberKey(req.IdempotencyKey, self))
+		if err == errDuplicate {
+			duplicates++
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(owners) > 0 && duplicates == len(owners) {
+		return nil, errDuplicate
+	}
+	return rejections, nil
+}
+
+// memberKey returns the idempotency key of the entries of
+// a request owned by member. The key doesn't depend on the
+// member receiving the request, so retries sent to another
+// member are deduplicated too.
+func memberKey(key, member string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "@" + member
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mykodev/myko/cluster"
+	"github.com/mykodev/myko/config"
+	"github.com/twitchtv/twirp"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func TestInsertEvents_Cluster(t *testing.T) {
+	servers := make([]*Server, 2)
+	var members []string
+	for i := range servers {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cluster.Authenticate("secret", pb.NewServiceServer(servers[i], nil)).ServeHTTP(w, r)
+		}))
+		defer ts.Close()
+		members = append(members, ts.URL)
+	}
+	for i := range servers {
+		c, err := cluster.New(config.ClusterConfig{Self: members[i], Members: members, Secret: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[i] = newTestServer(t)
+		servers[i].cluster = c
+	}
+
+	var entries []*pb.Entry
+	for i := 0; i < 20; i++ {
+		entries = append(entries, &pb.Entry{
+			Target: "mysql",
+			Origin: "origin_" + strconv.Itoa(i),
+			Events: []*pb.Event{{Name: "query_count", Value: 1}},
+		})
+	}
+	req := &pb.InsertEventsRequest{Entries: entries, IdempotencyKey: "batch-1"}
+	ctx := context.Background()
+	resp, err := servers[0].InsertEvents(ctx, req)
+	if err != nil {
+		t.Fatalf("InsertEvents() = %v", err)
+	}
+	if resp.Accepted != 20 || resp.Duplicate {
+		t.Errorf("InsertEvents() = %v, want 20 accepted", resp)
+	}
+	// A retry sent to another member is a duplicate too.
+	if resp, err := servers[1].InsertEvents(ctx, req); err != nil || !resp.Duplicate {
+		t.Errorf("InsertEvents() = %v, %v; want a duplicate", resp, err)
+	}
+
+	var total int
+	for i, s := range servers {
+		for _, w := range s.batchWriter.windows {
+			w.summer.ForEach(func(target, origin string, ev *pb.Event) {
+				total++
+				if owner := s.cluster.Owner(target + ":" + origin); owner != members[i] {
+					t.Errorf("%q aggregated %q owned by %q", members[i], origin, owner)
+				}
+				if ev.Value != 1 {
+					t.Errorf("query_count of %q = %v, want 1", origin, ev.Value)
+				}
+			})
+		}
+	}
+	if total != 20 {
+		t.Errorf("aggregated %d events, want 20", total)
+	}
+}
+
+func TestInsertEvents_ClusterUnavailable(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	self := "http://myko-0:6959"
+	c, err := cluster.New(config.ClusterConfig{Self: self, Members: []string{self, down.URL}, Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.cluster = c
+
+	var entries []*pb.Entry
+	for i := 0; i < 20; i++ {
+		entries = append(entries, &pb.Entry{
+			Target: "mysql",
+			Origin: "origin_" + strconv.Itoa(i),
+			Events: []*pb.Event{{Name: "query_count", Value: 1}},
+		})
+	}
+	ctx := context.Background()
+	_, err = s.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries})
+	if twerr, ok := err.(twirp.Error); !ok || twerr.Code() != twirp.Unavailable {
+		t.Errorf("InsertEvents() = %v, want an unavailable error", err)
+	}
+	if len(s.batchWriter.windows) != 0 {
+		t.Errorf("InsertEvents() has aggregated entries while their owner is unavailable")
+	}
+
+	// Only members can forward entries.
+	_, err = s.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries, Forwarded: true})
+	if twerr, ok := err.(twirp.Error); !ok || twerr.Code() != twirp.PermissionDenied {
+		t.Errorf("InsertEvents() = %v, want a permission denied error", err)
+	}
+}
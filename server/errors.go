@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/twitchtv/twirp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// apiError is an error returned by the API. Twirp clients
+// receive its code, and gRPC clients the matching status code.
+type apiError struct {
+	twirpError
+}
+
+// twirpError names the embedded error,
+// so it doesn't shadow the Error method.
+type twirpError = twirp.Error
+
+// GRPCStatus returns the gRPC status of the error.
+func (e apiError) GRPCStatus() *status.Status {
+	code, ok := grpcCodes[e.Code()]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.New(code, e.Msg())
+}
+
+var grpcCodes = map[twirp.ErrorCode]codes.Code{
+	twirp.Canceled:           codes.Canceled,
+	twirp.Unknown:            codes.Unknown,
+	twirp.InvalidArgument:    codes.InvalidArgument,
+	twirp.Malformed:          codes.InvalidArgument,
+	twirp.DeadlineExceeded:   codes.DeadlineExceeded,
+	twirp.NotFound:           codes.NotFound,
+	twirp.BadRoute:           codes.NotFound,
+	twirp.AlreadyExists:      codes.AlreadyExists,
+	twirp.PermissionDenied:   codes.PermissionDenied,
+	twirp.Unauthenticated:    codes.Unauthenticated,
+	twirp.ResourceExhausted:  codes.ResourceExhausted,
+	twirp.FailedPrecondition: codes.FailedPrecondition,
+	twirp.Aborted:            codes.Aborted,
+	twirp.OutOfRange:         codes.OutOfRange,
+	twirp.Unimplemented:      codes.Unimplemented,
+	twirp.Internal:           codes.Internal,
+	twirp.Unavailable:        codes.Unavailable,
+	twirp.DataLoss:           codes.DataLoss,
+}
+
+// apiErr returns err as an API error. Errors carrying a Twirp
+// code keep it, others get code.
+func apiErr(code twirp.ErrorCode, err error) error {
+	var twerr twirp.Error
+	if errors.As(err, &twerr) {
+		return apiError{twerr}
+	}
+	return apiError{twirp.NewError(code, err.Error())}
+}
@@ -3,105 +3,586 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mykodev/myko/aggregator"
+	"github.com/mykodev/myko/cluster"
 	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/cumulative"
 	"github.com/mykodev/myko/datastore/kusto"
+	"github.com/mykodev/myko/dedup"
 	"github.com/mykodev/myko/format"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
 
 	pb "github.com/mykodev/myko/proto"
 )
 
+// Datastore is where the server writes the aggregated windows
+// and queries them from. It's implemented by kusto.Session.
+type Datastore interface {
+	IngestAll(ctx context.Context, entries []*kusto.Entry) error
+	Query(ctx context.Context, q kusto.Query) ([]*kusto.Entry, error)
+	Close() error
+}
+
 type Server struct {
-	session     *kusto.Session
+	session     Datastore
 	batchWriter *batchWriter
+
+	exact    map[string]int // decimal places of exact events
+	counters *cumulative.Tracker
+	keys     *dedup.Keys // idempotency keys of inserted requests
+
+	cluster *cluster.Cluster // nil if not clustered
+
+	// queryUnflushed makes queries merge the
+	// unflushed windows with the datastore results.
+	queryUnflushed bool
 }
 
+// errDuplicate is returned by the batch writer if the
+// idempotency key of the written entries is already seen.
+var errDuplicate = errors.New("duplicate request")
+
+// flushTick is how often Run looks for closed windows.
+const flushTick = time.Second
+
+// maxQueryAttempts is how many times queries of the unflushed
+// windows are attempted while windows are being flushed.
+const maxQueryAttempts = 3
+
 func New(cfg config.Config) (*Server, error) {
 	session, err := kusto.NewSession(cfg.DataConfig)
 	if err != nil {
 		return nil, err
 	}
-	server := &Server{session: session}
-	server.batchWriter = newBatchWriter(server, cfg.FlushConfig.BufferSize, cfg.FlushConfig.Interval)
+	return NewWithDatastore(cfg, session)
+}
+
+// NewWithDatastore returns a server writing to the datastore
+// rather than the one in the config.
+func NewWithDatastore(cfg config.Config, session Datastore) (*Server, error) {
+	var countersPath, keysPath string
+	if dir := cfg.StateConfig.Dir; dir != "" {
+		countersPath = filepath.Join(dir, "cumulative.json")
+		keysPath = filepath.Join(dir, "idempotency.json")
+	}
+	counters, err := cumulative.Open(countersPath, cfg.AggregationConfig.CumulativeExpiry)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := dedup.Open(keysPath, cfg.AggregationConfig.IdempotencyWindow)
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{
+		session:  session,
+		exact:    cfg.AggregationConfig.Exact,
+		counters: counters,
+		keys:     keys,
+
+		queryUnflushed: cfg.QueryConfig.Unflushed,
+	}
+	if cfg.ClusterConfig != nil {
+		if server.cluster, err = cluster.New(*cfg.ClusterConfig); err != nil {
+			return nil, err
+		}
+	}
+	server.batchWriter = newBatchWriter(server, cfg.FlushConfig)
 	return server, nil
 }
 
+// Close flushes all in-memory data points to the datastore
+// and saves the server state.
+func (s *Server) Close() error {
+	if err := s.batchWriter.Close(); err != nil {
+		return err
+	}
+	return s.session.Close()
+}
+
+// Run writes the windows to the datastore as they close and
+// watches the cluster members if clustered, until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	if s.cluster != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchCluster(ctx)
+		}()
+	}
+	ticker := time.NewTicker(flushTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b := s.batchWriter
+			b.mu.Lock()
+			if err := b.flush(time.Now(), false); err != nil {
+				log.Printf("Failed to flush: %v", err)
+			}
+			b.mu.Unlock()
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+	}
+}
+
 func (s *Server) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
-	return &pb.QueryResponse{}, errors.New("not yet supported")
+	q := kusto.Query{
+		Target:  req.Target,
+		Origin:  req.Origin,
+		Event:   req.Event,
+		EndTime: time.Now(),
+	}
+	if req.StartTime != nil {
+		q.StartTime = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		q.EndTime = req.EndTime.AsTime()
+	}
+	if !q.StartTime.Before(q.EndTime) {
+		return nil, apiErr(twirp.InvalidArgument, errors.New("start time should be before end time"))
+	}
+	unflushed, kEntries, err := s.query(ctx, q)
+	if err != nil {
+		return nil, apiErr(twirp.Unavailable, err)
+	}
+
+	// Merge the matching entries by event name, summing up
+	// values and merging sketches across windows and groups.
+	summer := aggregator.NewSummer(len(kEntries)).Exact(s.exact)
+	for _, ev := range unflushed {
+		if err := summer.Add("", "", ev); err != nil {
+			return nil, apiErr(twirp.Internal, err)
+		}
+	}
+	for _, e := range kEntries {
+		ev := &pb.Event{
+			Name:    e.Event,
+			Value:   e.Value,
+			Kind:    pb.Kind(pb.Kind_value[e.Kind]),
+			Count:   uint64(e.Count),
+			Sketch:  e.Sketch,
+			Decimal: e.Decimal,
+		}
+		if err := summer.Add("", "", ev); err != nil {
+			return nil, apiErr(twirp.Internal, err)
+		}
+	}
+	resp := &pb.QueryResponse{}
+	summer.ForEach(func(_, _ string, ev *pb.Event) {
+		resp.Events = append(resp.Events, ev)
+	})
+	sort.Sort(sortableEvents(resp.Events))
+	return resp, nil
 }
 
+// query queries the datastore and, if enabled, the unflushed
+// windows. Windows flushed while the datastore is queried may be
+// read twice or missed, so the query is retried if a flush starts
+// in the meantime.
+func (s *Server) query(ctx context.Context, q kusto.Query) (unflushed []*pb.Event, kEntries []*kusto.Entry, err error) {
+	if !s.queryUnflushed {
+		kEntries, err = s.session.Query(ctx, q)
+		return nil, kEntries, err
+	}
+	for i := 0; i < maxQueryAttempts; i++ {
+		unflushed, generation := s.batchWriter.unflushed(q)
+		kEntries, err = s.session.Query(ctx, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		if s.batchWriter.generation.Load() == generation {
+			return unflushed, kEntries, nil
+		}
+	}
+	return nil, nil, twirp.NewError(twirp.Unavailable, "windows are being flushed, retry the query")
+}
+
+// InsertEvents verifies and aggregates the entries. By default,
+// the request fails if any entry is invalid. Partial requests
+// aggregate the valid entries and list the rejected ones.
+// Requests with an already inserted idempotency key are
+// acknowledged as duplicates. Invalid requests fail with an
+// InvalidArgument error, and requests failing otherwise with
+// an Unavailable or Internal error.
 func (s *Server) InsertEvents(ctx context.Context, req *pb.InsertEventsRequest) (*pb.InsertEventsResponse, error) {
-	for _, entry := range req.Entries {
-		if err := format.Verify(entry); err != nil {
-			return nil, err
+	now := time.Now()
+	if req.Forwarded && s.cluster != nil && !cluster.IsMember(ctx) {
+		return nil, apiErr(twirp.PermissionDenied, errors.New("forwarded entries are accepted from cluster members only"))
+	}
+	// Cluster members forward the entries they don't own,
+	// and the owners deduplicate them.
+	forward := s.cluster != nil && !req.Forwarded
+	if !forward && req.IdempotencyKey != "" && s.keys.Seen(req.IdempotencyKey, now) {
+		return &pb.InsertEventsResponse{Duplicate: true}, nil
+	}
+	resp := &pb.InsertEventsResponse{}
+	accepted := make([]*pb.Entry, 0, len(req.Entries))
+	var indexes []uint32 // indexes of the accepted entries
+	for i, entry := range req.Entries {
+		if err := s.verify(entry, now, req.PreAggregated); err != nil {
+			if !req.Partial {
+				return nil, apiErr(twirp.InvalidArgument, err)
+			}
+			resp.Rejections = append(resp.Rejections, &pb.Rejection{
+				Index:  uint32(i),
+				Reason: err.Error(),
+			})
+			continue
 		}
+		accepted = append(accepted, entry)
+		indexes = append(indexes, uint32(i))
 	}
-	if err := s.batchWriter.Write(req.Entries); err != nil {
-		return nil, err
+	var err error
+	if forward {
+		var rejections []*pb.Rejection
+		rejections, err = s.insertClustered(ctx, req, accepted, indexes, now)
+		if len(rejections) > 0 {
+			resp.Rejections = append(resp.Rejections, rejections...)
+			sort.Slice(resp.Rejections, func(i, j int) bool {
+				return resp.Rejections[i].Index < resp.Rejections[j].Index
+			})
+		}
+	} else {
+		err = s.batchWriter.Write(accepted, now, req.IdempotencyKey)
 	}
-	return &pb.InsertEventsResponse{}, nil
+	if err == errDuplicate {
+		return &pb.InsertEventsResponse{Duplicate: true}, nil
+	}
+	if err != nil {
+		return nil, apiErr(twirp.Internal, err)
+	}
+	resp.Rejected = uint32(len(resp.Rejections))
+	resp.Accepted = uint32(len(req.Entries)) - resp.Rejected
+	return resp, nil
 }
 
-func newBatchWriter(server *Server, bufferSize int, flushInterval time.Duration) *batchWriter {
+// verify returns an error if the entry can't be aggregated.
+// Verified entries are aggregated without errors, so requests
+// are never aggregated partially. Entries of pre-aggregated
+// requests can be older than the tolerance.
+func (s *Server) verify(entry *pb.Entry, now time.Time, preAggregated bool) error {
+	if err := format.Verify(entry); err != nil {
+		return err
+	}
+	for _, ev := range entry.Events {
+		if err := aggregator.Verify(ev, s.exact); err != nil {
+			return err
+		}
+	}
+	return s.batchWriter.verifyTimestamp(entry, now, preAggregated)
+}
+
+// InsertEventsStream inserts the entries of every request
+// received from the stream as InsertEvents does. The response
+// sums up the accepted and rejected entries of all requests.
+func (s *Server) InsertEventsStream(stream pb.StreamService_InsertEventsStreamServer) error {
+	total := &pb.InsertEventsResponse{}
+	var received uint32
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(total)
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := s.InsertEvents(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		total.Accepted += resp.Accepted
+		total.Rejected += resp.Rejected
+		for _, r := range resp.Rejections {
+			r.Index += received
+			total.Rejections = append(total.Rejections, r)
+		}
+		received += uint32(len(req.Entries))
+	}
+}
+
+func newBatchWriter(server *Server, cfg config.FlushConfig) *batchWriter {
 	return &batchWriter{
 		server:        server,
-		bufferSize:    bufferSize,
-		flushInterval: flushInterval,
-		lastExport:    time.Now(),
-		summer:        aggregator.NewSummer(bufferSize),
+		bufferSize:    cfg.BufferSize,
+		flushInterval: cfg.Interval,
+		tolerance:     cfg.Tolerance,
+		windows:       make(map[time.Time]*window),
 	}
 }
 
 type batchWriter struct {
-	mu     sync.Mutex // guards summer
-	summer *aggregator.Summer
+	mu      sync.Mutex // guards windows
+	windows map[time.Time]*window
+
+	// generation is incremented when a flush starts writing
+	// windows, so queries reading the unflushed windows can tell
+	// whether the datastore results include windows they have
+	// read from memory.
+	generation atomic.Uint64
 
 	bufferSize    int
 	flushInterval time.Duration
-	lastExport    time.Time
+	tolerance     time.Duration
 
 	server *Server
 }
 
-func (b *batchWriter) Write(entries []*pb.Entry) error {
+// Write aggregates the entries received at now. The caller
+// needs to verify the entries, so they are aggregated without
+// errors. If key is set and already seen, the entries are not
+// aggregated and errDuplicate is returned, otherwise key is
+// marked as seen once the entries are aggregated.
+func (b *batchWriter) Write(entries []*pb.Entry, now time.Time, key string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	// Check again while holding the lock,
+	// concurrent retries may race.
+	if key != "" && b.server.keys.Seen(key, now) {
+		return errDuplicate
+	}
+
+	written := make(map[*window]bool)
 	for _, entry := range entries {
+		ts := b.timestamp(entry, now)
+		w := b.window(ts)
+		written[w] = true
 		for _, ev := range entry.Events {
-			b.summer.Add(entry.Target, entry.Origin, ev)
+			if ev.Kind == pb.Kind_CUMULATIVE {
+				key := entry.Source + ":" + entry.Target + ":" + entry.Origin + ":" + ev.Name
+				report := cumulative.Report{Value: ev.Value, Time: ts}
+				delta, ok := b.server.counters.Delta(key, report)
+				if !ok {
+					continue // out of order
+				}
+				w.reports[key] = report
+				if delta == 0 {
+					continue // first report or no increase
+				}
+				ev = &pb.Event{Name: ev.Name, Value: delta}
+			}
+			if err := w.summer.Add(entry.Target, entry.Origin, ev); err != nil {
+				// Unreachable for verified entries.
+				log.Printf("Failed to aggregate a verified event: %v", err)
+			}
 		}
 	}
-	return b.flushIfNeeded()
+	if key != "" {
+		b.server.keys.Add(key, now)
+		for w := range written {
+			w.keys[key] = now
+		}
+		if len(written) == 0 {
+			// Nothing to write, the key can be saved.
+			b.server.keys.Commit(map[string]time.Time{key: now})
+		}
+	}
+	// The entries are aggregated, failing the request would
+	// make the client retry them. Windows that fail to be
+	// flushed are kept and flushed again later.
+	if err := b.flushIfNeeded(now); err != nil {
+		log.Printf("Failed to flush: %v", err)
+	}
+	return nil
 }
 
-func (b *batchWriter) flushIfNeeded() error {
-	ctx := context.Background()
+func (b *batchWriter) timestamp(entry *pb.Entry, now time.Time) time.Time {
+	if entry.Timestamp == nil {
+		return now
+	}
+	return entry.Timestamp.AsTime()
+}
+
+// oldest returns the earliest timestamp accepted at now. Entries
+// are rejected and windows are closed by the same bound, so an
+// accepted entry falls into an open window, unless the entry is
+// pre-aggregated. Closed windows are written at the next flush.
+func (b *batchWriter) oldest(now time.Time) time.Time {
+	return now.Add(-b.tolerance)
+}
+
+// closed reports whether no more entries can fall into the
+// window starting at start.
+func (b *batchWriter) closed(start, now time.Time) bool {
+	return !start.Add(b.flushInterval).After(b.oldest(now))
+}
+
+// verifyTimestamp rejects entries that are later than now by
+// more than the tolerance, or earlier unless anyAge is set.
+func (b *batchWriter) verifyTimestamp(entry *pb.Entry, now time.Time, anyAge bool) error {
+	ts := b.timestamp(entry, now)
+	if oldest := b.oldest(now); !anyAge && ts.Before(oldest) {
+		return fmt.Errorf("entry timestamp %v is older than the tolerated %v", ts.Format(time.RFC3339), oldest.Format(time.RFC3339))
+	}
+	if latest := now.Add(b.tolerance); ts.After(latest) {
+		return fmt.Errorf("entry timestamp %v is later than the tolerated %v", ts.Format(time.RFC3339), latest.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// unflushed returns copies of the unflushed events matching q
+// and the flush generation they are read at.
+func (b *batchWriter) unflushed(q kusto.Query) (events []*pb.Event, generation uint64) {
+	// Acquiring b.mu waits for a flush in flight.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for start, w := range b.windows {
+		// Match the windows the datastore would return.
+		if start.Before(q.StartTime) || !start.Before(q.EndTime) {
+			continue
+		}
+		w.summer.ForEach(func(target, origin string, ev *pb.Event) {
+			if (q.Target != "" && target != q.Target) ||
+				(q.Origin != "" && origin != q.Origin) ||
+				(q.Event != "" && ev.Name != q.Event) {
+				return
+			}
+			events = append(events, proto.Clone(ev).(*pb.Event))
+		})
+	}
+	return events, b.generation.Load()
+}
+
+// window is an aggregation window and the state
+// to save once the window is written.
+type window struct {
+	summer *aggregator.Summer
+
+	// reports are the last reports of the
+	// counters whose deltas are in the window.
+	reports map[string]cumulative.Report
 
+	// keys are the idempotency keys of the
+	// requests whose entries are in the window.
+	keys map[string]time.Time
+}
+
+// window returns the aggregation window ts falls into. Windows
+// are aligned to the wall-clock multiples of the flush interval.
+func (b *batchWriter) window(ts time.Time) *window {
+	start := ts.Truncate(b.flushInterval)
+	w, ok := b.windows[start]
+	if !ok {
+		w = &window{
+			summer:  aggregator.NewSummer(b.bufferSize).Exact(b.server.exact),
+			reports: make(map[string]cumulative.Report),
+			keys:    make(map[string]time.Time),
+		}
+		b.windows[start] = w
+	}
+	return w
+}
+
+// Close flushes all windows, including the open ones.
+func (b *batchWriter) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if err := b.flush(now, true); err != nil {
+		return err
+	}
+	return b.server.saveState(now)
+}
+
+func (b *batchWriter) flushIfNeeded(now time.Time) error {
 	// flushIfNeeded need to be called from Write.
-	if size := b.summer.Size(); size >= b.bufferSize || b.lastExport.Before(time.Now().Add(-1*b.flushInterval)) {
-		log.Printf("Writing %d events", size)
-
-		kEntries := make([]*kusto.Entry, 0, b.summer.Size())
-		b.summer.ForEach(func(target, origin string, ev *pb.Event) {
-			kEntries = append(kEntries, &kusto.Entry{
-				Target: target,
-				Origin: origin,
-				Event:  ev.Name,
-				Value:  ev.Value,
+	var size int
+	for _, w := range b.windows {
+		size += w.summer.Size()
+	}
+	return b.flush(now, size >= b.bufferSize)
+}
+
+// flush writes the closed windows to the datastore in the order
+// they start, and stops at the first window failing to be
+// written. If all is set, open windows are written too and the
+// remaining entries of open windows are written as additional
+// data points of the same window. The caller needs to hold b.mu.
+func (b *batchWriter) flush(now time.Time, all bool) error {
+	ctx := context.Background()
+
+	var starts []time.Time
+	for start := range b.windows {
+		if all || b.closed(start, now) {
+			starts = append(starts, start)
+		}
+	}
+	if len(starts) == 0 {
+		return nil
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	b.generation.Add(1)
+	for _, start := range starts {
+		w := b.windows[start]
+		if w.summer.Size() > 0 {
+			log.Printf("Writing %d events of the window starting at %v", w.summer.Size(), start.Format(time.RFC3339))
+			kEntries := make([]*kusto.Entry, 0, w.summer.Size())
+			w.summer.ForEach(func(target, origin string, ev *pb.Event) {
+				kEntries = append(kEntries, &kusto.Entry{
+					Timestamp: start,
+					Target:    target,
+					Origin:    origin,
+					Event:     ev.Name,
+					Kind:      ev.Kind.String(),
+					Value:     ev.Value,
+					Count:     int64(ev.Count),
+					Sketch:    ev.Sketch,
+					Decimal:   ev.Decimal,
+				})
 			})
-		})
-		if err := b.server.session.IngestAll(ctx, kEntries); err != nil {
-			return err
+			if err := b.server.session.IngestAll(ctx, kEntries); err != nil {
+				return err
+			}
 		}
-		b.summer.Reset()
-		b.lastExport = time.Now()
+		delete(b.windows, start)
+		b.server.counters.Commit(w.reports)
+		b.commitKeys(w.keys)
 	}
-	return nil
+	// Save the counters and the idempotency keys
+	// along with the written windows.
+	return b.server.saveState(now)
+}
+
+// commitKeys commits the keys of a written window that
+// are not in the remaining windows. The caller needs to
+// hold b.mu.
+func (b *batchWriter) commitKeys(keys map[string]time.Time) {
+	committed := make(map[string]time.Time, len(keys))
+	for key, t := range keys {
+		committed[key] = t
+	}
+	for _, w := range b.windows {
+		for key := range w.keys {
+			delete(committed, key)
+		}
+	}
+	b.server.keys.Commit(committed)
+}
+
+// saveState saves the state that needs to survive restarts.
+func (s *Server) saveState(now time.Time) error {
+	if err := s.counters.Save(now); err != nil {
+		return err
+	}
+	return s.keys.Save(now)
 }
 
 type sortableEvents []*pb.Event
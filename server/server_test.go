@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/cumulative"
+	"github.com/mykodev/myko/datastore/kusto"
+	"github.com/mykodev/myko/dedup"
+	"github.com/mykodev/myko/mykotest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+func newTestServer(t *testing.T) *Server {
+	counters, err := cumulative.Open("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := dedup.Open("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{counters: counters, keys: keys}
+	s.batchWriter = newBatchWriter(s, config.DefaultConfig().FlushConfig)
+	return s
+}
+
+func TestInsertEvents_Partial(t *testing.T) {
+	entries := []*pb.Entry{
+		{Target: "mysql", Origin: "site_navbar", Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+		{Target: "mysql", Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+		{Target: "mysql", Origin: "checkout", Timestamp: timestamppb.New(time.Now().Add(-24 * time.Hour))},
+		{Target: "mysql", Origin: "checkout", Events: []*pb.Event{{Name: "query_count", Value: 2}}},
+		{Target: "db1:3306/shop", Origin: "checkout", Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+	}
+
+	s := newTestServer(t)
+	if _, err := s.InsertEvents(context.Background(), &pb.InsertEventsRequest{Entries: entries}); err == nil {
+		t.Fatalf("InsertEvents() = nil error, want error")
+	}
+	if len(s.batchWriter.windows) != 0 {
+		t.Errorf("InsertEvents() has aggregated entries of a failed request")
+	}
+
+	resp, err := s.InsertEvents(context.Background(), &pb.InsertEventsRequest{Entries: entries, Partial: true})
+	if err != nil {
+		t.Fatalf("InsertEvents() = %v", err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 3 {
+		t.Errorf("accepted, rejected = %v, %v; want 2, 3", resp.Accepted, resp.Rejected)
+	}
+	if len(resp.Rejections) != 3 || resp.Rejections[0].Index != 1 || resp.Rejections[1].Index != 2 || resp.Rejections[2].Index != 4 {
+		t.Errorf("rejections = %v, want entries 1, 2 and 4", resp.Rejections)
+	}
+	var size int
+	for _, w := range s.batchWriter.windows {
+		size += w.summer.Size()
+	}
+	if size != 2 {
+		t.Errorf("aggregated %d events, want 2", size)
+	}
+}
+
+func TestInsertEvents_OutOfRange(t *testing.T) {
+	entries := []*pb.Entry{
+		{Target: "billing", Origin: "checkout", Events: []*pb.Event{{Name: "invoice_usd", Decimal: "10.05"}}},
+		{Target: "billing", Origin: "checkout", Events: []*pb.Event{{Name: "invoice_usd", Decimal: "99999999999999999999"}}},
+	}
+
+	s := newTestServer(t)
+	s.exact = map[string]int{"invoice_usd": 2}
+	if _, err := s.InsertEvents(context.Background(), &pb.InsertEventsRequest{Entries: entries}); err == nil {
+		t.Fatalf("InsertEvents() = nil error, want error")
+	}
+	if len(s.batchWriter.windows) != 0 {
+		t.Errorf("InsertEvents() has aggregated entries of a failed request")
+	}
+	resp, err := s.InsertEvents(context.Background(), &pb.InsertEventsRequest{Entries: entries, Partial: true})
+	if err != nil {
+		t.Fatalf("InsertEvents() = %v", err)
+	}
+	if resp.Accepted != 1 || len(resp.Rejections) != 1 || resp.Rejections[0].Index != 1 {
+		t.Errorf("InsertEvents() = %v, want entry 1 rejected", resp)
+	}
+}
+
+func TestInsertEvents_PreAggregated(t *testing.T) {
+	datastore := &mykotest.Datastore{}
+	s := newTestServer(t)
+	s.session = datastore
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	req := &pb.InsertEventsRequest{Entries: []*pb.Entry{
+		{Target: "mysql", Origin: "checkout", Timestamp: timestamppb.New(start), Events: []*pb.Event{{Name: "query_count", Value: 3, Count: 3}}},
+	}}
+	if _, err := s.InsertEvents(context.Background(), req); err == nil {
+		t.Fatalf("InsertEvents() = nil error for a late entry, want error")
+	}
+	req.PreAggregated = true
+	if _, err := s.InsertEvents(context.Background(), req); err != nil {
+		t.Fatalf("InsertEvents() = %v", err)
+	}
+	// The window is closed and written right away.
+	entries := datastore.Entries()
+	if len(entries) != 1 || !entries[0].Timestamp.Equal(start) || entries[0].Value != 3 {
+		t.Errorf("datastore entries = %v, want the window starting at %v", entries, start)
+	}
+}
+
+func TestBatchWriter_Timestamps(t *testing.T) {
+	s := newTestServer(t)
+	b := s.batchWriter
+	now := time.Date(2024, 5, 1, 12, 5, 10, 0, time.UTC)
+	tests := []struct {
+		ts      time.Time
+		wantErr bool
+	}{
+		{ts: now},
+		{ts: now.Add(-b.tolerance)},
+		{ts: now.Add(-b.tolerance - time.Nanosecond), wantErr: true},
+		{ts: now.Add(b.tolerance)},
+		{ts: now.Add(b.tolerance + time.Nanosecond), wantErr: true},
+	}
+	for _, tt := range tests {
+		entry := &pb.Entry{Target: "mysql", Origin: "checkout", Timestamp: timestamppb.New(tt.ts)}
+		if err := b.verifyTimestamp(entry, now, false); (err != nil) != tt.wantErr {
+			t.Errorf("verifyTimestamp(%v) = %v, want error = %v", tt.ts, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBatchWriter_Windows(t *testing.T) {
+	datastore := &mykotest.Datastore{}
+	s := newTestServer(t)
+	s.session = datastore
+	b := s.batchWriter
+
+	// Interval is 1m and tolerance is 30s.
+	now := time.Date(2024, 5, 1, 12, 5, 10, 0, time.UTC)
+	entries := []*pb.Entry{
+		{Target: "mysql", Origin: "checkout", Timestamp: timestamppb.New(now.Add(-b.tolerance)), Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+		{Target: "mysql", Origin: "checkout", Events: []*pb.Event{{Name: "query_count", Value: 2}}},
+	}
+	if err := b.Write(entries, now, ""); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	first := time.Date(2024, 5, 1, 12, 4, 0, 0, time.UTC)
+	second := time.Date(2024, 5, 1, 12, 5, 0, 0, time.UTC)
+	if len(b.windows) != 2 || b.windows[first] == nil || b.windows[second] == nil {
+		t.Fatalf("windows = %v, want windows starting at %v and %v", b.windows, first, second)
+	}
+
+	// The first window closes once its end is older than the
+	// tolerance, when entries of the window are rejected.
+	closing := first.Add(b.flushInterval + b.tolerance)
+	if err := b.flush(closing.Add(-time.Nanosecond), false); err != nil {
+		t.Fatalf("flush() = %v", err)
+	}
+	if len(datastore.Entries()) != 0 {
+		t.Errorf("flush() has written %d entries of open windows", len(datastore.Entries()))
+	}
+	if err := b.flush(closing, false); err != nil {
+		t.Fatalf("flush() = %v", err)
+	}
+	if len(datastore.Entries()) != 1 || !datastore.Entries()[0].Timestamp.Equal(first) || datastore.Entries()[0].Value != 1 {
+		t.Errorf("flush() has written %v, want the window starting at %v", datastore.Entries(), first)
+	}
+	late := &pb.Entry{Target: "mysql", Origin: "checkout", Timestamp: timestamppb.New(second.Add(-time.Nanosecond))}
+	if err := b.verifyTimestamp(late, closing, false); err == nil {
+		t.Errorf("verifyTimestamp() = nil error for an entry of a closed window")
+	}
+	if err := b.verifyTimestamp(late, closing, true); err != nil {
+		t.Errorf("verifyTimestamp() = %v for a pre-aggregated entry of a closed window", err)
+	}
+}
+
+func TestBatchWriter_Cumulative(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cumulative.json")
+	counters, err := cumulative.Open(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.session = &mykotest.Datastore{}
+	s.counters = counters
+	b := s.batchWriter
+
+	now := time.Date(2024, 5, 1, 12, 5, 10, 0, time.UTC)
+	report := func(value float64, ts time.Time) *pb.Entry {
+		return &pb.Entry{Target: "mysql", Origin: "checkout", Source: "host1", Timestamp: timestamppb.New(ts), Events: []*pb.Event{
+			{Name: "bytes_read", Kind: pb.Kind_CUMULATIVE, Value: value},
+		}}
+	}
+	entries := []*pb.Entry{
+		report(100, now.Add(-20*time.Second)),
+		report(150, now.Add(-15*time.Second)),
+		report(400, now),
+		report(120, now.Add(-10*time.Second)), // out of order
+	}
+	if err := b.Write(entries, now, ""); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	var deltas []float64
+	for _, w := range b.windows {
+		w.summer.ForEach(func(_, _ string, ev *pb.Event) {
+			deltas = append(deltas, ev.Value)
+		})
+	}
+	sort.Float64s(deltas)
+	if want := []float64{50, 250}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas = %v, want %v", deltas, want)
+	}
+
+	// Only the reports of the written window are saved.
+	if err := b.flush(now.Add(b.tolerance), false); err != nil {
+		t.Fatalf("flush() = %v", err)
+	}
+	reopened, err := cumulative.Open(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta, _ := reopened.Delta("host1:mysql:checkout:bytes_read", cumulative.Report{Value: 400, Time: now}); delta != 250 {
+		t.Errorf("Delta() after restart = %v, want 250", delta)
+	}
+}
+
+func TestInsertEvents_Idempotent(t *testing.T) {
+	req := &pb.InsertEventsRequest{
+		Entries: []*pb.Entry{
+			{Target: "mysql", Origin: "site_navbar", Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+		},
+		IdempotencyKey: "batch-1",
+	}
+
+	s := newTestServer(t)
+	for i, want := range []bool{false, true} {
+		resp, err := s.InsertEvents(context.Background(), req)
+		if err != nil {
+			t.Fatalf("InsertEvents() = %v", err)
+		}
+		if resp.Duplicate != want {
+			t.Errorf("InsertEvents() #%d duplicate = %v, want %v", i, resp.Duplicate, want)
+		}
+	}
+	for _, w := range s.batchWriter.windows {
+		w.summer.ForEach(func(_, _ string, ev *pb.Event) {
+			if ev.Value != 1 {
+				t.Errorf("query_count = %v, want 1", ev.Value)
+			}
+		})
+	}
+}
+
+func TestQuery_Unflushed(t *testing.T) {
+	now := time.Now()
+	datastore := &mykotest.Datastore{}
+	datastore.IngestAll(context.Background(), []*kusto.Entry{
+		{Timestamp: now.Add(-time.Hour), Target: "mysql", Origin: "site_navbar", Event: "query_count", Kind: "SUM", Value: 3, Count: 3},
+	})
+	req := &pb.InsertEventsRequest{Entries: []*pb.Entry{
+		{Target: "mysql", Origin: "site_navbar", Events: []*pb.Event{{Name: "query_count", Value: 2}}},
+		{Target: "mysql", Origin: "checkout", Events: []*pb.Event{{Name: "query_count", Value: 5}}},
+	}}
+	query := &pb.QueryRequest{
+		Target:    "mysql",
+		Origin:    "site_navbar",
+		StartTime: timestamppb.New(now.Add(-2 * time.Hour)),
+	}
+
+	tests := []struct {
+		unflushed bool
+		want      float64
+	}{
+		{unflushed: false, want: 3},
+		{unflushed: true, want: 5},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t)
+		s.session = datastore
+		s.queryUnflushed = tt.unflushed
+		if _, err := s.InsertEvents(context.Background(), req); err != nil {
+			t.Fatalf("InsertEvents() = %v", err)
+		}
+		resp, err := s.Query(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Query() = %v", err)
+		}
+		if len(resp.Events) != 1 || resp.Events[0].Value != tt.want {
+			t.Errorf("Query() with unflushed = %v returned %v, want query_count = %v", tt.unflushed, resp.Events, tt.want)
+		}
+	}
+}
+
+func TestQuery_UnflushedDuringFlush(t *testing.T) {
+	datastore := &mykotest.Datastore{}
+	s := newTestServer(t)
+	s.session = datastore
+	s.queryUnflushed = true
+	req := &pb.InsertEventsRequest{Entries: []*pb.Entry{
+		{Target: "mysql", Origin: "site_navbar", Events: []*pb.Event{{Name: "query_count", Value: 2}}},
+	}}
+	if _, err := s.InsertEvents(context.Background(), req); err != nil {
+		t.Fatalf("InsertEvents() = %v", err)
+	}
+
+	// Flush the window while the first query reads the datastore.
+	var queries int
+	datastore.OnQuery = func() {
+		if queries++; queries == 1 {
+			b := s.batchWriter
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if err := b.flush(time.Now(), true); err != nil {
+				t.Errorf("flush() = %v", err)
+			}
+		}
+	}
+	resp, err := s.Query(context.Background(), &pb.QueryRequest{Target: "mysql", Origin: "site_navbar"})
+	if err != nil {
+		t.Fatalf("Query() = %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Value != 2 {
+		t.Errorf("Query() = %v, want query_count = 2", resp.Events)
+	}
+	if queries != 2 {
+		t.Errorf("datastore is queried %d times, want 2", queries)
+	}
+}
+
+func TestBatchWriter_IdempotencyKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	keys, err := dedup.Open(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.session = &mykotest.Datastore{}
+	s.keys = keys
+	b := s.batchWriter
+
+	now := time.Date(2024, 5, 1, 12, 5, 10, 0, time.UTC)
+	entries := []*pb.Entry{
+		{Target: "mysql", Origin: "checkout", Timestamp: timestamppb.New(now.Add(-20 * time.Second)), Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+		{Target: "mysql", Origin: "checkout", Events: []*pb.Event{{Name: "query_count", Value: 1}}},
+	}
+	if err := b.Write(entries, now, "batch-1"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := b.Write(entries, now, "batch-1"); err != errDuplicate {
+		t.Fatalf("Write() = %v, want %v", err, errDuplicate)
+	}
+
+	// The key is saved once all of its windows are written.
+	for _, tt := range []struct {
+		all      bool
+		wantSeen bool
+	}{
+		{all: false, wantSeen: false},
+		{all: true, wantSeen: true},
+	} {
+		if err := b.flush(now.Add(b.tolerance), tt.all); err != nil {
+			t.Fatalf("flush() = %v", err)
+		}
+		reopened, err := dedup.Open(path, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen := reopened.Seen("batch-1", now); seen != tt.wantSeen {
+			t.Errorf("Seen() after flush(all = %v) = %v, want %v", tt.all, seen, tt.wantSeen)
+		}
+	}
+}
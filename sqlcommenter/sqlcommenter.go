@@ -0,0 +1,96 @@
+// Package sqlcommenter parses the attributes SQL queries are
+// tagged with in sqlcommenter comments, such as:
+//
+//	SELECT * FROM users /*controller='nav',route='site_navbar'*/
+//
+// See https://google.github.io/sqlcommenter/spec/.
+package sqlcommenter
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Parse returns the attributes of the last comment in query.
+// It returns nil if the query has no comment in sqlcommenter
+// format.
+func Parse(query string) map[string]string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	end := strings.LastIndex(query, "*/")
+	if end < 0 {
+		return nil
+	}
+	start := strings.LastIndex(query[:end], "/*")
+	if start < 0 {
+		return nil
+	}
+	comment := strings.TrimSpace(query[start+2 : end])
+	if comment == "" {
+		return nil
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range splitPairs(comment) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+			return nil
+		}
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			return nil
+		}
+		// Values are URL encoded, quotes are escaped with backslashes.
+		value := strings.ReplaceAll(v[1:len(v)-1], `\'`, `'`)
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil
+		}
+		attrs[key] = value
+	}
+	return attrs
+}
+
+// Format appends a comment with the attributes to query, sorted
+// by key. Queries that already have a comment are returned as is,
+// as the spec requires.
+func Format(query string, attrs map[string]string) string {
+	if len(attrs) == 0 || strings.Contains(query, "/*") || strings.Contains(query, "--") {
+		return query
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		// The spec encodes spaces as %20 rather than +.
+		v := strings.ReplaceAll(url.QueryEscape(attrs[k]), "+", "%20")
+		pairs = append(pairs, strings.ReplaceAll(url.QueryEscape(k), "+", "%20")+"='"+v+"'")
+	}
+	comment := "/*" + strings.Join(pairs, ",") + "*/"
+
+	trimmed := strings.TrimRight(query, "; \t\n")
+	return trimmed + " " + comment + query[len(trimmed):]
+}
+
+// splitPairs splits the comment by the commas
+// that are not in quoted values.
+func splitPairs(comment string) []string {
+	var pairs []string
+	var quoted bool
+	var start int
+	for i := 0; i < len(comment); i++ {
+		switch {
+		case comment[i] == '\\':
+			i++ // skip the escaped character
+		case comment[i] == '\'':
+			quoted = !quoted
+		case comment[i] == ',' && !quoted:
+			pairs = append(pairs, comment[start:i])
+			start = i + 1
+		}
+	}
+	return append(pairs, comment[start:])
+}
@@ -0,0 +1,67 @@
+package sqlcommenter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  map[string]string
+	}{
+		{
+			query: "SELECT * FROM users /*controller='nav',route='site_navbar'*/;",
+			want:  map[string]string{"controller": "nav", "route": "site_navbar"},
+		},
+		{
+			query: "SELECT 1 /*route='%2Fapi%2Fusers%2F%3Aid',traceparent='00-abc-def-01'*/",
+			want:  map[string]string{"route": "/api/users/:id", "traceparent": "00-abc-def-01"},
+		},
+		{
+			query: `SELECT 1 /*comment='it\'s, here'*/`,
+			want:  map[string]string{"comment": "it's, here"},
+		},
+		{
+			query: "SELECT /* hint */ 1",
+			want:  nil,
+		},
+		{
+			query: "SELECT 1",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		query string
+		attrs map[string]string
+		want  string
+	}{
+		{
+			query: "SELECT * FROM users;",
+			attrs: map[string]string{"route": "/users/:id", "controller": "site navbar"},
+			want:  "SELECT * FROM users /*controller='site%20navbar',route='%2Fusers%2F%3Aid'*/;",
+		},
+		{
+			query: "SELECT 1 /* hint */",
+			attrs: map[string]string{"route": "site_navbar"},
+			want:  "SELECT 1 /* hint */",
+		},
+	}
+	for _, tt := range tests {
+		got := Format(tt.query, tt.attrs)
+		if got != tt.want {
+			t.Errorf("Format(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		if tt.query != tt.want && !reflect.DeepEqual(Parse(got), tt.attrs) {
+			t.Errorf("Parse(%q) = %v, want %v", got, Parse(got), tt.attrs)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/mykodev/myko/atomicfile"
+)
+
+// fingerprintSize is the number of bytes at the beginning of a
+// file used to tell whether the file at a path is still the same
+// file after a restart, or it has been rotated.
+const fingerprintSize = 1024
+
+type checkpoint struct {
+	Offset      int64  `json:"offset"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func loadCheckpoints(path string) (map[string]checkpoint, error) {
+	checkpoints := make(map[string]checkpoint)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// saveCheckpoints writes the checkpoints to path at once, so a
+// crash never leaves a partial file behind.
+func saveCheckpoints(path string, checkpoints map[string]checkpoint) error {
+	return atomicfile.WriteJSON(path, checkpoints)
+}
+
+// fingerprint hashes the first bytes of f, up to fingerprintSize
+// or n bytes, whichever is smaller.
+func fingerprint(f *os.File, n int64) (string, error) {
+	if n > fingerprintSize {
+		n = fingerprintSize
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, n)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,226 @@
+package tail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+// maxReadSize is the number of bytes read from a file at once
+// at most. Longer lines are skipped.
+const maxReadSize = 1 << 20
+
+// follower reads the complete lines appended to a file. It
+// follows the path across rotations, once the current file is
+// read to the end and the path points to a new file, it starts
+// reading the new file from the beginning.
+type follower struct {
+	path   string
+	f      *os.File
+	offset int64 // offset of the first unread byte
+
+	// next is the offset after the lines returned by
+	// the last read, it becomes offset when committed.
+	next int64
+
+	// ends are the offsets after each of the lines
+	// returned by the last read.
+	ends []int64
+
+	// full is set if the last read has filled its buffer.
+	full bool
+
+	// skip is set while the rest of a line longer
+	// than maxReadSize is skipped.
+	skip bool
+}
+
+// openFollower opens the file at path and starts reading it from
+// the checkpoint if the checkpoint belongs to the same file.
+// Otherwise, it starts after the last line of the file, or from
+// the beginning if fromStart is set. Files created later are
+// always read from the beginning.
+func openFollower(path string, cp checkpoint, fromStart bool) (*follower, error) {
+	fl := &follower{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fl, nil // wait for the file to be created
+	}
+	if err != nil {
+		return nil, err
+	}
+	fl.f = f
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if cp.Offset > 0 && cp.Offset <= fi.Size() {
+		fp, err := fingerprint(f, cp.Offset)
+		if err != nil {
+			return nil, err
+		}
+		if fp == cp.Fingerprint {
+			fl.offset, fl.next = cp.Offset, cp.Offset
+			return fl, nil
+		}
+	}
+	if !fromStart {
+		end, err := lastLineEnd(f, fi.Size())
+		if err != nil {
+			return nil, err
+		}
+		fl.offset, fl.next = end, end
+	}
+	return fl, nil
+}
+
+// lastLineEnd returns the offset after the last complete line
+// of the file of the given size.
+func lastLineEnd(f *os.File, size int64) (int64, error) {
+	start := size - maxReadSize
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, size-start)
+	if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+	i := bytes.LastIndexByte(buf, '\n')
+	if i < 0 && start > 0 {
+		return size, nil // in a line longer than maxReadSize
+	}
+	return start + int64(i) + 1, nil
+}
+
+// read returns the complete lines after the committed offset.
+// The lines are read again unless commit is called.
+func (fl *follower) read() ([]string, error) {
+	if fl.f == nil {
+		if err := fl.reopen(); err != nil || fl.f == nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, maxReadSize)
+	for {
+		n, err := fl.f.ReadAt(buf, fl.offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		b := buf[:n]
+		if fl.skip {
+			i := bytes.IndexByte(b, '\n')
+			if i < 0 {
+				fl.offset += int64(n)
+				fl.next = fl.offset
+				if n < maxReadSize {
+					return nil, fl.checkRotation()
+				}
+				continue
+			}
+			fl.skip = false
+			fl.offset += int64(i) + 1
+			fl.next = fl.offset
+			continue
+		}
+
+		end := bytes.LastIndexByte(b, '\n')
+		if end < 0 {
+			if n == maxReadSize {
+				log.Printf("Skipping a line of %q longer than %d bytes", fl.path, maxReadSize)
+				fl.skip = true
+				continue
+			}
+			// No complete lines, the file might have been rotated.
+			return nil, fl.checkRotation()
+		}
+		fl.next = fl.offset + int64(end) + 1
+		fl.full = n == maxReadSize
+		lines := splitLines(b[:end])
+		fl.ends = fl.ends[:0]
+		pos := fl.offset
+		for _, line := range bytes.Split(b[:end], []byte{'\n'}) {
+			pos += int64(len(line)) + 1
+			fl.ends = append(fl.ends, pos)
+		}
+		return lines, nil
+	}
+}
+
+// commit commits the first n lines returned by the last read,
+// the lines after them are read again.
+func (fl *follower) commit(n int) {
+	if n == 0 {
+		fl.next = fl.offset
+		return
+	}
+	fl.offset = fl.ends[n-1]
+	fl.next = fl.offset
+}
+
+func (fl *follower) checkpoint() (checkpoint, error) {
+	if fl.f == nil {
+		return checkpoint{}, nil
+	}
+	fp, err := fingerprint(fl.f, fl.offset)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	return checkpoint{Offset: fl.offset, Fingerprint: fp}, nil
+}
+
+// checkRotation switches to the file at the path if it's not the
+// current file anymore, or starts over if the file is truncated.
+func (fl *follower) checkRotation() error {
+	current, err := fl.f.Stat()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(fl.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // the new file is not created yet
+	}
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(current, fi) {
+		fl.f.Close()
+		return fl.reopen()
+	}
+	if fi.Size() < fl.offset {
+		fl.offset, fl.next, fl.skip = 0, 0, false
+	}
+	return nil
+}
+
+func (fl *follower) reopen() error {
+	fl.f = nil
+	fl.offset, fl.next, fl.skip = 0, 0, false
+	f, err := os.Open(fl.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fl.f = f
+	return nil
+}
+
+func (fl *follower) close() error {
+	if fl.f == nil {
+		return nil
+	}
+	return fl.f.Close()
+}
+
+func splitLines(b []byte) []string {
+	lines := make([]string, 0, bytes.Count(b, []byte{'\n'})+1)
+	for _, line := range bytes.Split(b, []byte{'\n'}) {
+		lines = append(lines, string(bytes.TrimSuffix(line, []byte{'\r'})))
+	}
+	return lines
+}
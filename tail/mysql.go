@@ -0,0 +1,130 @@
+package tail
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mykodev/myko/config"
+)
+
+// mysqlSlowParser parses the records of MySQL slow query logs:
+//
+//	# Time: 2023-01-10T12:00:00.123456Z
+//	# User@Host: app[app] @ web1 [10.0.0.1]  Id:    12
+//	# Query_time: 0.012345  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 1000
+//	use shop;
+//	SET timestamp=1673352000;
+//	SELECT * FROM users /*route='site_navbar'*/;
+//
+// The "Key: value" pairs of the header lines become fields with
+// lower case keys, such as time, query_time and rows_examined.
+// The time field is RFC 3339, the "# Time: 190515 10:00:00"
+// header of MySQL 5.6 and older is converted in the local time
+// zone. The statement is the query field and the database the
+// session uses is the db field.
+type mysqlSlowParser struct {
+	fields map[string]string // fields of the record being parsed
+	lines  int               // lines of the record being parsed
+	query  strings.Builder
+	db     string // the database the session has switched to last
+}
+
+// mysqlTimeLayout is the time layout of MySQL 5.6 and older.
+const mysqlTimeLayout = "060102 15:04:05"
+
+// mysqlSlowDefaults are the defaults of the mysql_slow format.
+// The target is the database, the events are the query count,
+// latency and the number of examined rows.
+func mysqlSlowDefaults(cfg *config.TailFileConfig) {
+	if cfg.Target == "" && cfg.TargetField == "" {
+		cfg.TargetField = "db"
+	}
+	if cfg.TimeField == "" {
+		cfg.TimeField = "time"
+	}
+	if cfg.SQLCommenterField == "" {
+		cfg.SQLCommenterField = "query"
+	}
+	if len(cfg.Events) == 0 {
+		cfg.Events = []config.EventMappingConfig{
+			{Name: "sql_query_count"},
+			{Name: "sql_query_latency_ms", Field: "query_time", Scale: 1000},
+			{Name: "sql_rows_examined", Field: "rows_examined"},
+		}
+	}
+}
+
+func (p *mysqlSlowParser) parse(line string) (map[string]string, bool, error) {
+	if strings.HasPrefix(line, "#") {
+		if p.fields == nil || p.query.Len() > 0 {
+			// A new record, drop the incomplete statement if any.
+			p.reset()
+			p.fields = make(map[string]string)
+		}
+		p.lines++
+		parseHeader(line[1:], p.fields)
+		return nil, false, nil
+	}
+	if p.fields == nil {
+		return nil, false, nil // server preamble between records
+	}
+	p.lines++
+
+	stmt := strings.TrimSpace(line)
+	if p.query.Len() == 0 {
+		lower := strings.ToLower(stmt)
+		if strings.HasPrefix(lower, "use ") {
+			p.db = strings.Trim(stmt[4:], "`; ")
+			return nil, false, nil
+		}
+		if strings.HasPrefix(lower, "set timestamp=") {
+			return nil, false, nil
+		}
+	} else {
+		p.query.WriteByte('\n')
+	}
+	p.query.WriteString(stmt)
+	if !strings.HasSuffix(stmt, ";") {
+		return nil, false, nil
+	}
+
+	fields := p.fields
+	fields["query"] = p.query.String()
+	if fields["db"] == "" {
+		fields["db"] = p.db
+		if schema := fields["schema"]; schema != "" {
+			fields["db"] = schema
+		}
+	}
+	p.reset()
+	return fields, true, nil
+}
+
+func (p *mysqlSlowParser) pending() int {
+	return p.lines
+}
+
+func (p *mysqlSlowParser) reset() {
+	p.fields = nil
+	p.lines = 0
+	p.query.Reset()
+}
+
+// parseHeader parses the "Key: value" pairs of a header line.
+func parseHeader(line string, fields map[string]string) {
+	if line = strings.TrimSpace(line); strings.HasPrefix(line, "Time:") {
+		v := strings.Join(strings.Fields(line[len("Time:"):]), " ")
+		if t, err := time.ParseInLocation(mysqlTimeLayout, v, time.Local); err == nil {
+			v = t.Format(time.RFC3339Nano)
+		}
+		fields["time"] = v
+		return
+	}
+	tokens := strings.Fields(line)
+	for i := 0; i < len(tokens)-1; i++ {
+		if key := tokens[i]; len(key) > 1 && strings.HasSuffix(key, ":") {
+			fields[strings.ToLower(strings.TrimSuffix(key, ":"))] = tokens[i+1]
+			i++
+		}
+	}
+}
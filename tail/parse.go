@@ -0,0 +1,131 @@
+package tail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mykodev/myko/config"
+)
+
+// parser parses lines into the fields of records. Parsers
+// may keep state to parse records spanning multiple lines,
+// ok is false until a line completes a record.
+type parser interface {
+	parse(line string) (fields map[string]string, ok bool, err error)
+}
+
+// recordParser is a parser of records spanning multiple lines.
+type recordParser interface {
+	parser
+
+	// pending returns the number of lines parsed
+	// into the record that is not complete yet.
+	pending() int
+
+	// reset drops the incomplete record.
+	reset()
+}
+
+func newParser(cfg config.TailFileConfig) (parser, error) {
+	switch cfg.Format {
+	case "regex":
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &regexParser{re: re}, nil
+	case "json":
+		return jsonParser{}, nil
+	case "logfmt":
+		return logfmtParser{}, nil
+	case "mysql_slow":
+		return &mysqlSlowParser{}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+}
+
+type regexParser struct {
+	re *regexp.Regexp
+}
+
+func (p *regexParser) parse(line string) (map[string]string, bool, error) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false, errors.New("line doesn't match the pattern")
+	}
+	fields := make(map[string]string)
+	for i, name := range p.re.SubexpNames() {
+		if name != "" {
+			fields[name] = m[i]
+		}
+	}
+	return fields, true, nil
+}
+
+// jsonParser parses the top-level fields of JSON objects.
+// Nested objects and arrays are kept as JSON.
+type jsonParser struct{}
+
+func (jsonParser) parse(line string) (map[string]string, bool, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, false, err
+	}
+	fields := make(map[string]string, len(obj))
+	for k, v := range obj {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			fields[k] = s
+		} else {
+			fields[k] = string(v)
+		}
+	}
+	return fields, true, nil
+}
+
+// logfmtParser parses key=value pairs. Values can be quoted,
+// keys without values are set to "true".
+type logfmtParser struct{}
+
+func (logfmtParser) parse(line string) (map[string]string, bool, error) {
+	fields := make(map[string]string)
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		end := strings.IndexAny(line, "= ")
+		if end < 0 {
+			end = len(line)
+		}
+		key := line[:end]
+		line = line[end:]
+		if key == "" {
+			return nil, false, errors.New("malformed logfmt key")
+		}
+		if !strings.HasPrefix(line, "=") {
+			fields[key] = "true"
+			continue
+		}
+		line = line[1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, false, fmt.Errorf("malformed logfmt value of %q", key)
+			}
+			value, _ = strconv.Unquote(quoted)
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			value, line = line[:end], line[end:]
+		}
+		fields[key] = value
+	}
+	return fields, true, nil
+}
@@ -0,0 +1,177 @@
+// Package tail follows log files, parses their lines into
+// entries and inserts them. Read offsets are checkpointed
+// after the entries are inserted, so restarts continue after
+// the last inserted lines. Lines are inserted again if tail
+// stops before their offset is checkpointed, and lines
+// appended to a file after it has been rotated and read to
+// the end are skipped, as are lines longer than 1 MiB.
+package tail
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/receiver"
+	"github.com/mykodev/myko/sqlcommenter"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+type Tailer struct {
+	cfg      config.TailConfig
+	inserter receiver.Inserter
+	files    []*file
+
+	checkpoints map[string]checkpoint
+}
+
+type file struct {
+	cfg      config.TailFileConfig
+	parser   parser
+	mapper   *receiver.Mapper
+	follower *follower
+}
+
+func New(cfg config.TailConfig, inserter receiver.Inserter) (*Tailer, error) {
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = time.Second
+	}
+	checkpoints, err := loadCheckpoints(cfg.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tailer{
+		cfg:         cfg,
+		inserter:    inserter,
+		checkpoints: checkpoints,
+	}
+	for _, fc := range cfg.Files {
+		if fc.Format == "mysql_slow" {
+			mysqlSlowDefaults(&fc)
+		}
+		m, err := receiver.NewMapper(fc.EntryMappingConfig, nil)
+		if err != nil {
+			return nil, err
+		}
+		p, err := newParser(fc)
+		if err != nil {
+			return nil, err
+		}
+		fl, err := openFollower(fc.Path, checkpoints[fc.Path], fc.FromStart)
+		if err != nil {
+			return nil, err
+		}
+		t.files = append(t.files, &file{cfg: fc, parser: p, mapper: m, follower: fl})
+	}
+	return t, nil
+}
+
+// Run follows the files until ctx is done.
+func (t *Tailer) Run(ctx context.Context) error {
+	defer t.close()
+
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, f := range t.files {
+			if err := t.tail(ctx, f); err != nil {
+				log.Printf("Failed to tail %q: %v", f.cfg.Path, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// tail inserts the entries parsed from the new lines of the file.
+// The offset is committed only if the entries are inserted.
+func (t *Tailer) tail(ctx context.Context, f *file) error {
+	for {
+		lines, err := f.follower.read()
+		if err != nil || len(lines) == 0 {
+			return err
+		}
+
+		var entries []*pb.Entry
+		var failed int
+		for _, line := range lines {
+			fields, ok, err := f.parser.parse(line)
+			if err != nil {
+				failed++
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if field := f.cfg.SQLCommenterField; field != "" {
+				for k, v := range sqlcommenter.Parse(fields[field]) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+			}
+			entry, err := f.mapper.Entry(fields)
+			if err != nil {
+				failed++
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		if failed > 0 {
+			log.Printf("Failed to parse %d lines of %q", failed, f.cfg.Path)
+		}
+
+		// Commit only complete records, so a restart doesn't
+		// continue in the middle of a record. The lines of the
+		// incomplete record are read again with the next lines,
+		// unless the record doesn't fit in a read.
+		commit := len(lines)
+		rp, ok := f.parser.(recordParser)
+		if ok {
+			if pending := rp.pending(); pending < len(lines) || !f.follower.full {
+				rp.reset()
+				commit -= pending
+			}
+		}
+		if len(entries) > 0 {
+			// Insert partially, otherwise an invalid entry would
+			// block the file as its offset is never committed.
+			resp, err := t.inserter.InsertEvents(ctx, &pb.InsertEventsRequest{Entries: entries, Partial: true})
+			if err != nil {
+				if rp != nil {
+					rp.reset() // the lines are read again
+				}
+				return err
+			}
+			if len(resp.Rejections) > 0 {
+				log.Printf("Rejected %d entries of %q: %v", len(resp.Rejections), f.cfg.Path, resp.Rejections[0].Reason)
+			}
+		}
+
+		f.follower.commit(commit)
+		cp, err := f.follower.checkpoint()
+		if err != nil {
+			return err
+		}
+		t.checkpoints[f.cfg.Path] = cp
+		if t.cfg.Checkpoint != "" {
+			if err := saveCheckpoints(t.cfg.Checkpoint, t.checkpoints); err != nil {
+				return err
+			}
+		}
+		if commit < len(lines) {
+			return nil // wait for the rest of the record
+		}
+	}
+}
+
+func (t *Tailer) close() {
+	for _, f := range t.files {
+		f.follower.close()
+	}
+}
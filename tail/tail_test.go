@@ -0,0 +1,258 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/mykotest"
+)
+
+func TestTailer(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	cfg := config.TailConfig{
+		Checkpoint: filepath.Join(dir, "checkpoint.json"),
+		Files: []config.TailFileConfig{{
+			Path:   logPath,
+			Format: "logfmt",
+			EntryMappingConfig: config.EntryMappingConfig{
+				Target:      "webserver",
+				OriginField: "route",
+				Events: []config.EventMappingConfig{
+					{Name: "request_count"},
+					{Name: "request_ms", Field: "duration", Scale: 1000},
+				},
+			},
+		}},
+	}
+
+	// The lines written before the start are skipped.
+	appendFile(t, logPath, "route=historic duration=1\n")
+	inserter := &mykotest.Service{}
+	tailer, err := New(cfg, inserter)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	appendFile(t, logPath, "route=site_navbar duration=0.5\nroute=checkout duration=0.25\nroute=site_")
+	tailer.tail(ctx, tailer.files[0])
+	assertOrigins(t, inserter, "site_navbar", "checkout")
+	if got := inserter.Entries()[0].Events[1].Value; got != 500 {
+		t.Errorf("request_ms = %v, want 500", got)
+	}
+
+	// Complete the partial line, then rotate the file.
+	appendFile(t, logPath, "navbar duration=1\n")
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, logPath, "route=search duration=1\n")
+	tailer.tail(ctx, tailer.files[0])
+	tailer.tail(ctx, tailer.files[0])
+	assertOrigins(t, inserter, "site_navbar", "checkout", "site_navbar", "search")
+	tailer.close()
+
+	// Restart and continue from the checkpoint.
+	appendFile(t, logPath, "route=checkout duration=2\n")
+	inserter = &mykotest.Service{}
+	tailer, err = New(cfg, inserter)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	defer tailer.close()
+	tailer.tail(ctx, tailer.files[0])
+	assertOrigins(t, inserter, "checkout")
+}
+
+func TestTailer_NoCheckpoint(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	cfg := config.TailConfig{
+		Files: []config.TailFileConfig{{
+			Path:   logPath,
+			Format: "logfmt",
+			EntryMappingConfig: config.EntryMappingConfig{
+				Target:      "webserver",
+				OriginField: "route",
+				Events:      []config.EventMappingConfig{{Name: "request_count"}},
+			},
+		}},
+	}
+	inserter := &mykotest.Service{}
+	tailer, err := New(cfg, inserter)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	defer tailer.close()
+	for _, origin := range []string{"site_navbar", "checkout"} {
+		appendFile(t, logPath, "route="+origin+"\n")
+		if err := tailer.tail(context.Background(), tailer.files[0]); err != nil {
+			t.Fatalf("tail() = %v", err)
+		}
+	}
+	assertOrigins(t, inserter, "site_navbar", "checkout")
+}
+
+func TestTailer_MySQLSlowRecords(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "slow.log")
+	cfg := config.TailConfig{
+		Checkpoint: filepath.Join(dir, "checkpoint.json"),
+		Files: []config.TailFileConfig{{
+			Path:               logPath,
+			Format:             "mysql_slow",
+			EntryMappingConfig: config.EntryMappingConfig{Target: "mysql", OriginField: "route"},
+		}},
+	}
+	inserter := &mykotest.Service{}
+	tailer, err := New(cfg, inserter)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	// The second record is incomplete, so the checkpoint
+	// is at its beginning.
+	appendFile(t, logPath, `# Time: 2023-01-10T12:00:00Z
+# Query_time: 0.01  Lock_time: 0 Rows_sent: 1  Rows_examined: 10
+use shop;
+SELECT 1 /*route='site_navbar'*/;
+# Time: 2023-01-10T12:00:01Z
+# Query_time: 0.02  Lock_time: 0 Rows_sent: 1  Rows_examined: 20
+SELECT 2
+`)
+	tailer.tail(ctx, tailer.files[0])
+	tailer.close()
+	assertOrigins(t, inserter, "site_navbar")
+
+	appendFile(t, logPath, "/*route='checkout'*/;\n")
+	inserter = &mykotest.Service{}
+	tailer, err = New(cfg, inserter)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	defer tailer.close()
+	tailer.tail(ctx, tailer.files[0])
+	assertOrigins(t, inserter, "checkout")
+	if e := inserter.Entries()[0]; e.Events[2].Value != 20 || e.Timestamp.AsTime().Unix() != 1673352001 {
+		t.Errorf("entry = %v, want the complete second record", e)
+	}
+}
+
+func TestFollower_LongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	appendFile(t, path, "route=historic\n")
+	fl, err := openFollower(path, checkpoint{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fl.close()
+
+	lines, err := fl.read()
+	if err != nil || len(lines) != 1 {
+		t.Fatalf("read() = %q, %v; want the first line", lines, err)
+	}
+	fl.commit(len(lines))
+
+	// A line longer than maxReadSize is skipped even
+	// while it's still being written.
+	appendFile(t, path, "route="+strings.Repeat("x", maxReadSize))
+	if lines, err := fl.read(); err != nil || len(lines) != 0 {
+		t.Fatalf("read() = %q, %v; want no lines", lines, err)
+	}
+	appendFile(t, path, strings.Repeat("x", 100)+"\nroute=site_navbar\n")
+	lines, err = fl.read()
+	if err != nil {
+		t.Fatalf("read() = %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "route=site_navbar" {
+		t.Errorf("read() = %q, want the line after the long line", lines)
+	}
+}
+
+func TestLogfmtParser(t *testing.T) {
+	fields, ok, err := logfmtParser{}.parse(`route=site_navbar msg="slow query" cached duration=0.5`)
+	if err != nil || !ok {
+		t.Fatalf("parse() = %v, %v", ok, err)
+	}
+	want := map[string]string{"route": "site_navbar", "msg": "slow query", "cached": "true", "duration": "0.5"}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("fields[%q] = %q, want %q", k, fields[k], v)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertOrigins(t *testing.T, inserter *mykotest.Service, want ...string) {
+	t.Helper()
+	entries := inserter.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Origin != want[i] {
+			t.Errorf("entries[%d].Origin = %q, want %q", i, e.Origin, want[i])
+		}
+	}
+}
+
+func TestMySQLSlowParser_Time(t *testing.T) {
+	// MySQL 5.6 and older write the time in the local time zone.
+	fields := make(map[string]string)
+	parseHeader(" Time: 190515  9:00:00", fields)
+	want := time.Date(2019, 5, 15, 9, 0, 0, 0, time.Local).Format(time.RFC3339Nano)
+	if fields["time"] != want {
+		t.Errorf("time = %q, want %q", fields["time"], want)
+	}
+}
+
+func TestMySQLSlowParser(t *testing.T) {
+	lines := []string{
+		"/usr/sbin/mysqld, Version: 8.0.32. started with:",
+		"# Time: 2023-01-10T12:00:00.123456Z",
+		"# User@Host: app[app] @ web1 [10.0.0.1]  Id:    12",
+		"# Query_time: 0.012345  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 1000",
+		"use shop;",
+		"SET timestamp=1673352000;",
+		"SELECT * FROM users",
+		"WHERE id = 1 /*controller='users',route='site_navbar'*/;",
+	}
+	p := &mysqlSlowParser{}
+	var fields map[string]string
+	for _, line := range lines {
+		f, ok, err := p.parse(line)
+		if err != nil {
+			t.Fatalf("parse(%q) = %v", line, err)
+		}
+		if ok {
+			fields = f
+		}
+	}
+	want := map[string]string{
+		"time":          "2023-01-10T12:00:00.123456Z",
+		"query_time":    "0.012345",
+		"rows_examined": "1000",
+		"db":            "shop",
+		"query":         "SELECT * FROM users\nWHERE id = 1 /*controller='users',route='site_navbar'*/;",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("fields[%q] = %q, want %q", k, fields[k], v)
+		}
+	}
+}
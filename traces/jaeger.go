@@ -0,0 +1,81 @@
+package traces
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type jaegerFile struct {
+	Data []jaegerTrace `json:"data"`
+}
+
+type jaegerTrace struct {
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+}
+
+type jaegerSpan struct {
+	TraceID       string            `json:"traceID"`
+	SpanID        string            `json:"spanID"`
+	OperationName string            `json:"operationName"`
+	References    []jaegerReference `json:"references"`
+	StartTime     int64             `json:"startTime"` // microseconds since epoch
+	Duration      int64             `json:"duration"`  // microseconds
+	Tags          []jaegerTag       `json:"tags"`
+	ProcessID     string            `json:"processID"`
+}
+
+type jaegerReference struct {
+	RefType string `json:"refType"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerTag struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type jaegerProcess struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// ReadJaeger reads the spans of traces in the JSON format
+// of the Jaeger query API and UI exports.
+func ReadJaeger(r io.Reader) ([]*Span, error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	var f jaegerFile
+	if err := d.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode Jaeger traces: %w", err)
+	}
+
+	var spans []*Span
+	for _, t := range f.Data {
+		for _, js := range t.Spans {
+			s := &Span{
+				TraceID:  js.TraceID,
+				ID:       js.SpanID,
+				Name:     js.OperationName,
+				Service:  t.Processes[js.ProcessID].ServiceName,
+				Start:    time.UnixMicro(js.StartTime),
+				Duration: time.Duration(js.Duration) * time.Microsecond,
+				Tags:     make(map[string]string, len(js.Tags)),
+			}
+			for _, ref := range js.References {
+				// Prefer the CHILD_OF parent over FOLLOWS_FROM.
+				if s.ParentID == "" || ref.RefType == "CHILD_OF" {
+					s.ParentID = ref.SpanID
+				}
+			}
+			for _, tag := range js.Tags {
+				s.Tags[tag.Key] = fmt.Sprint(tag.Value)
+			}
+			s.Kind = strings.ToLower(s.Tags["span.kind"])
+			spans = append(spans, s)
+		}
+	}
+	return spans, nil
+}
@@ -0,0 +1,168 @@
+// Package traces reads exported traces and attributes the
+// downstream calls in them to the origin of their root span.
+package traces
+
+import (
+	"time"
+
+	"github.com/mykodev/myko/aggregator"
+	"github.com/mykodev/myko/config"
+	"github.com/mykodev/myko/format"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/mykodev/myko/proto"
+)
+
+// Span is a span read from a trace export.
+type Span struct {
+	TraceID  string
+	ID       string
+	ParentID string
+	Name     string
+	Service  string
+
+	// Kind is the lower case span kind, such as
+	// client, server, producer or consumer.
+	Kind string
+
+	Start    time.Time
+	Duration time.Duration
+	Tags     map[string]string
+}
+
+// Attributor attributes client and producer spans to the
+// origin of the root span of their trace.
+type Attributor struct {
+	cfg      config.OTLPTracesConfig
+	interval time.Duration
+}
+
+// NewAttributor returns an attributor that maps spans as the
+// OTLP receiver does. The attributed spans are aggregated into
+// windows of the given interval, or only with the spans that
+// have started at the same time if the interval is zero.
+func NewAttributor(cfg config.OTLPTracesConfig, interval time.Duration) *Attributor {
+	if len(cfg.OriginAttributes) == 0 {
+		cfg.OriginAttributes = []string{"http.route", "rpc.method"}
+	}
+	if len(cfg.TargetAttributes) == 0 {
+		cfg.TargetAttributes = []string{"peer.service", "db.system", "net.peer.name"}
+	}
+	if cfg.CountEvent == "" {
+		cfg.CountEvent = "span_count"
+	}
+	if cfg.DurationEvent == "" {
+		cfg.DurationEvent = "span_duration_ms"
+	}
+	return &Attributor{cfg: cfg, interval: interval}
+}
+
+// Entries walks the trace trees and returns an entry for every
+// target, origin and window with the number and the total
+// duration of the calls. The target of a call is the first
+// target attribute set on the span, or the service of the span
+// it has called if the attributes are not set. Calls whose root
+// span is missing are attributed to the unknown origin.
+func (a *Attributor) Entries(spans []*Span) ([]*pb.Entry, error) {
+	type id struct{ traceID, spanID string }
+	byID := make(map[id]*Span, len(spans))
+	children := make(map[id][]*Span)
+	for _, s := range spans {
+		byID[id{s.TraceID, s.ID}] = s
+		if s.ParentID != "" {
+			parent := id{s.TraceID, s.ParentID}
+			children[parent] = append(children[parent], s)
+		}
+	}
+
+	windows := make(map[time.Time]*aggregator.Summer)
+	for _, s := range spans {
+		// Walk up at most len(spans) ancestors in case
+		// the parent references contain a cycle.
+		root := s
+		for i := 0; i < len(spans) && root.ParentID != ""; i++ {
+			parent, ok := byID[id{root.TraceID, root.ParentID}]
+			if !ok {
+				break
+			}
+			root = parent
+		}
+
+		var target string
+		switch {
+		case s.Kind == "client" || s.Kind == "producer":
+			for _, key := range a.cfg.TargetAttributes {
+				if target = s.Tags[key]; target != "" {
+					break
+				}
+			}
+			if target == "" {
+				for _, child := range children[id{s.TraceID, s.ID}] {
+					if child.Service != "" && child.Service != s.Service {
+						target = child.Service
+						break
+					}
+				}
+			}
+		case a.cfg.ServiceTarget && s.ParentID == "":
+			target = s.Service
+		}
+		if target == "" {
+			continue
+		}
+
+		start := s.Start.Truncate(a.interval)
+		summer, ok := windows[start]
+		if !ok {
+			summer = aggregator.NewSummer(0)
+			windows[start] = summer
+		}
+		origin := unknownOrigin
+		if root.ParentID == "" {
+			origin = a.origin(root)
+		}
+		target, origin = format.Name(target), format.Name(origin)
+		if err := summer.Add(target, origin, &pb.Event{Name: a.cfg.CountEvent, Value: 1}); err != nil {
+			return nil, err
+		}
+		duration := float64(s.Duration) / float64(time.Millisecond)
+		if err := summer.Add(target, origin, &pb.Event{Name: a.cfg.DurationEvent, Value: duration}); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []*pb.Entry
+	for start, summer := range windows {
+		ts := timestamppb.New(start)
+		byKey := make(map[[2]string]*pb.Entry)
+		summer.ForEach(func(target, origin string, ev *pb.Event) {
+			e, ok := byKey[[2]string{target, origin}]
+			if !ok {
+				e = &pb.Entry{Target: target, Origin: origin, Timestamp: ts}
+				byKey[[2]string{target, origin}] = e
+				entries = append(entries, e)
+			}
+			e.Events = append(e.Events, ev)
+		})
+	}
+	return entries, nil
+}
+
+// unknownOrigin is the origin of the calls whose root span
+// isn't in the same export, e.g. its trace has been sampled
+// or exported in parts.
+const unknownOrigin = "unknown"
+
+func (a *Attributor) origin(root *Span) string {
+	origin := root.Name
+	for _, key := range a.cfg.OriginAttributes {
+		if v := root.Tags[key]; v != "" {
+			origin = v
+			break
+		}
+	}
+	if a.cfg.OriginService {
+		origin = root.Service + "/" + origin
+	}
+	return origin
+}
@@ -0,0 +1,109 @@
+package traces
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mykodev/myko/config"
+)
+
+const jaegerTraces = `{"data": [{
+	"traceID": "t1",
+	"spans": [
+		{"traceID": "t1", "spanID": "root", "operationName": "GET /nav", "startTime": 1673352000000000, "duration": 30000,
+		 "tags": [{"key": "span.kind", "type": "string", "value": "server"}, {"key": "http.route", "type": "string", "value": "site_navbar"}],
+		 "processID": "p1"},
+		{"traceID": "t1", "spanID": "query", "operationName": "SELECT", "startTime": 1673352000001000, "duration": 12500,
+		 "references": [{"refType": "CHILD_OF", "traceID": "t1", "spanID": "root"}],
+		 "tags": [{"key": "span.kind", "type": "string", "value": "client"}, {"key": "db.system", "type": "string", "value": "mysql"}],
+		 "processID": "p1"},
+		{"traceID": "t1", "spanID": "call", "operationName": "GET /users", "startTime": 1673352000002000, "duration": 5000,
+		 "references": [{"refType": "CHILD_OF", "traceID": "t1", "spanID": "root"}],
+		 "tags": [{"key": "span.kind", "type": "string", "value": "client"}],
+		 "processID": "p1"},
+		{"traceID": "t1", "spanID": "served", "operationName": "GET /users", "startTime": 1673352000002500, "duration": 4000,
+		 "references": [{"refType": "CHILD_OF", "traceID": "t1", "spanID": "call"}],
+		 "tags": [{"key": "span.kind", "type": "string", "value": "server"}],
+		 "processID": "p2"}
+	],
+	"processes": {"p1": {"serviceName": "webserver"}, "p2": {"serviceName": "users"}}
+}]}`
+
+const zipkinTraces = `[[
+	{"traceId": "t1", "id": "root", "name": "get /nav", "kind": "SERVER", "timestamp": 1673352000000000, "duration": 30000,
+	 "localEndpoint": {"serviceName": "webserver"}, "tags": {"http.route": "site_navbar"}},
+	{"traceId": "t1", "id": "query", "parentId": "root", "name": "select", "kind": "CLIENT", "timestamp": 1673352000001000, "duration": 12500,
+	 "localEndpoint": {"serviceName": "webserver"}, "tags": {"db.system": "mysql"}},
+	{"traceId": "t1", "id": "call", "parentId": "root", "name": "get /users", "kind": "CLIENT", "timestamp": 1673352000002000, "duration": 5000,
+	 "localEndpoint": {"serviceName": "webserver"}, "remoteEndpoint": {"serviceName": "users"}}
+]]`
+
+func TestEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		read   func(string) ([]*Span, error)
+		traces string
+	}{
+		{"jaeger", func(s string) ([]*Span, error) { return ReadJaeger(strings.NewReader(s)) }, jaegerTraces},
+		{"zipkin", func(s string) ([]*Span, error) { return ReadZipkin(strings.NewReader(s)) }, zipkinTraces},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans, err := tt.read(tt.traces)
+			if err != nil {
+				t.Fatalf("read() = %v", err)
+			}
+			a := NewAttributor(config.OTLPTracesConfig{OriginService: true}, time.Minute)
+			entries, err := a.Entries(spans)
+			if err != nil {
+				t.Fatalf("Entries() = %v", err)
+			}
+			got := make(map[string]float64)
+			for _, e := range entries {
+				if e.Origin != "webserver/site_navbar" {
+					t.Errorf("origin = %q, want webserver/site_navbar", e.Origin)
+				}
+				if want := time.Unix(1673352000, 0).UTC(); !e.Timestamp.AsTime().Equal(want) {
+					t.Errorf("timestamp = %v, want %v", e.Timestamp.AsTime(), want)
+				}
+				for _, ev := range e.Events {
+					got[e.Target+" "+ev.Name] = ev.Value
+				}
+			}
+			want := map[string]float64{
+				"mysql span_count":       1,
+				"mysql span_duration_ms": 12.5,
+				"users span_count":       1,
+				"users span_duration_ms": 5,
+			}
+			if len(got) != len(want) {
+				t.Errorf("events = %v, want %v", got, want)
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestEntries_UnknownOrigin(t *testing.T) {
+	// The parent of the server span hasn't been exported.
+	spans := []*Span{
+		{TraceID: "t1", ID: "served", ParentID: "call", Name: "GET /users", Service: "users", Kind: "server", Tags: map[string]string{"http.route": "users"}},
+		{TraceID: "t1", ID: "query", ParentID: "served", Name: "SELECT", Service: "users", Kind: "client", Tags: map[string]string{"db.system": "mysql"}},
+	}
+	a := NewAttributor(config.OTLPTracesConfig{ServiceTarget: true}, time.Minute)
+	entries, err := a.Entries(spans)
+	if err != nil {
+		t.Fatalf("Entries() = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("len(entries) = %v, want 1", len(entries))
+	}
+	if e := entries[0]; e.Target != "mysql" || e.Origin != "unknown" {
+		t.Errorf("entry = %v/%v, want mysql/unknown", e.Target, e.Origin)
+	}
+}
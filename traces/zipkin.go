@@ -0,0 +1,78 @@
+package traces
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type zipkinSpan struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId"`
+	Name           string            `json:"name"`
+	Kind           string            `json:"kind"`
+	Timestamp      int64             `json:"timestamp"` // microseconds since epoch
+	Duration       int64             `json:"duration"`  // microseconds
+	LocalEndpoint  zipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint zipkinEndpoint    `json:"remoteEndpoint"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// ReadZipkin reads the spans of traces in the Zipkin v2 JSON
+// format, either a list of spans or a list of traces as returned
+// by the /api/v2/traces endpoint. The service name of the remote
+// endpoint is the peer.service tag unless the tag is set.
+func ReadZipkin(r io.Reader) ([]*Span, error) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to decode Zipkin traces: %w", err)
+	}
+
+	var zspans []zipkinSpan
+	for _, item := range items {
+		var err error
+		if bytes.HasPrefix(bytes.TrimSpace(item), []byte("[")) {
+			var trace []zipkinSpan
+			err = json.Unmarshal(item, &trace)
+			zspans = append(zspans, trace...)
+		} else {
+			var span zipkinSpan
+			err = json.Unmarshal(item, &span)
+			zspans = append(zspans, span)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Zipkin traces: %w", err)
+		}
+	}
+
+	spans := make([]*Span, 0, len(zspans))
+	for _, zs := range zspans {
+		s := &Span{
+			TraceID:  zs.TraceID,
+			ID:       zs.ID,
+			ParentID: zs.ParentID,
+			Name:     zs.Name,
+			Service:  zs.LocalEndpoint.ServiceName,
+			Kind:     strings.ToLower(zs.Kind),
+			Start:    time.UnixMicro(zs.Timestamp),
+			Duration: time.Duration(zs.Duration) * time.Microsecond,
+			Tags:     zs.Tags,
+		}
+		if s.Tags == nil {
+			s.Tags = make(map[string]string)
+		}
+		if remote := zs.RemoteEndpoint.ServiceName; remote != "" && s.Tags["peer.service"] == "" {
+			s.Tags["peer.service"] = remote
+		}
+		spans = append(spans, s)
+	}
+	return spans, nil
+}